@@ -0,0 +1,288 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package api
+
+import (
+    "fmt"
+    "net"
+    "time"
+    "strings"
+    "net/url"
+    "net/http"
+    "crypto/subtle"
+    "encoding/json"
+
+    "github.com/op/go-logging"
+
+    "github.com/mandrakey/dnsync/bind"
+    "github.com/mandrakey/dnsync/config"
+    "github.com/mandrakey/dnsync/handler"
+    "github.com/mandrakey/dnsync/state"
+    "github.com/mandrakey/dnsync/webhook"
+)
+
+// HTTP management API for listing and editing the zones of all handlers that manage a zone set. Every request
+// must carry the configured token as "Authorization: Bearer <token>".
+//
+//     GET    /zones                   zones of all handlers, keyed by handler name
+//     GET    /zones/<handler>         zones of one handler
+//     GET    /zones/<handler>/<zone>  a single zone
+//     POST   /zones/<handler>         add a zone, given as JSON object with name, masters and optionally file
+//     DELETE /zones/<handler>/<zone>  remove a zone
+type API struct {
+    stores map[string]handler.ZoneStore
+    state state.Store
+    hooks *webhook.Dispatcher
+    token string
+    log *logging.Logger
+}
+
+// Create a new API for the given handlers, requiring token for authentication. Handlers not managing a zone set
+// are ignored. Removed zones are forgotten in store, so a later NOTIFY adds them again. Changes are reported to
+// hooks, which may be nil.
+func New(handlers []handler.Handler, store state.Store, hooks *webhook.Dispatcher, token string,
+        log *logging.Logger) *API {
+    a := &API{stores: make(map[string]handler.ZoneStore), state: store, hooks: hooks, token: token, log: log}
+    for _, h := range handlers {
+        if store, ok := h.(handler.ZoneStore); ok {
+            a.stores[h.Name()] = store
+        }
+    }
+    return a
+}
+
+// Handle an API request.
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    if !a.authorized(r) {
+        w.Header().Set("WWW-Authenticate", "Bearer")
+        writeError(w, http.StatusUnauthorized, "Unauthorized")
+        return
+    }
+
+    // Split the escaped path, so zone names may contain slashes sent as %2F, e.g. classless reverse zones
+    parts := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+    if parts[0] != "zones" || len(parts) > 3 {
+        writeError(w, http.StatusNotFound, "Not found")
+        return
+    }
+    for i, part := range parts {
+        unescaped, err := url.PathUnescape(part); if err != nil {
+            writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid path: %s", err))
+            return
+        }
+        parts[i] = unescaped
+    }
+    if len(parts) == 3 {
+        zoneName, err := bind.NormalizeZoneName(parts[2]); if err != nil {
+            writeError(w, http.StatusBadRequest, err.Error())
+            return
+        }
+        parts[2] = zoneName
+    }
+
+    switch {
+    case len(parts) == 1 && r.Method == http.MethodGet:
+        a.listAll(w)
+    case len(parts) == 2 && r.Method == http.MethodGet:
+        a.list(w, parts[1])
+    case len(parts) == 2 && r.Method == http.MethodPost:
+        a.add(w, r, parts[1])
+    case len(parts) == 3 && r.Method == http.MethodGet:
+        a.show(w, parts[1], parts[2])
+    case len(parts) == 3 && r.Method == http.MethodDelete:
+        a.remove(w, r, parts[1], parts[2])
+    default:
+        writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+    }
+}
+
+// Check whether or not the request carries the configured token as bearer token. Without a configured token,
+// nobody is authorized.
+func (a *API) authorized(r *http.Request) bool {
+    header := r.Header.Get("Authorization")
+    if !strings.HasPrefix(header, "Bearer ") {
+        return false
+    }
+    token := strings.TrimPrefix(header, "Bearer ")
+    return a.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
+
+// Write the zones of all handlers.
+func (a *API) listAll(w http.ResponseWriter) {
+    res := make(map[string][]*bind.Zone)
+    for name, store := range a.stores {
+        zones, err := store.Zones(); if err != nil {
+            writeError(w, http.StatusInternalServerError, err.Error())
+            return
+        }
+        res[name] = zones
+    }
+    writeJSON(w, http.StatusOK, res)
+}
+
+// Write the zones of the handler name.
+func (a *API) list(w http.ResponseWriter, name string) {
+    store := a.store(w, name); if store == nil {
+        return
+    }
+
+    zones, err := store.Zones(); if err != nil {
+        writeError(w, http.StatusInternalServerError, err.Error())
+        return
+    }
+    writeJSON(w, http.StatusOK, zones)
+}
+
+// Write a single zone of the handler name.
+func (a *API) show(w http.ResponseWriter, name, zoneName string) {
+    store := a.store(w, name); if store == nil {
+        return
+    }
+
+    zones, err := store.Zones(); if err != nil {
+        writeError(w, http.StatusInternalServerError, err.Error())
+        return
+    }
+    for _, zone := range zones {
+        if zone.Name == zoneName {
+            writeJSON(w, http.StatusOK, zone)
+            return
+        }
+    }
+    writeError(w, http.StatusNotFound, fmt.Sprintf("No such zone: %s", zoneName))
+}
+
+// Add the zone in the request body to the handler name.
+func (a *API) add(w http.ResponseWriter, r *http.Request, name string) {
+    store := a.store(w, name); if store == nil {
+        return
+    }
+
+    zone := &bind.Zone{}
+    err := json.NewDecoder(r.Body).Decode(zone); if err != nil {
+        writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid zone: %s", err))
+        return
+    }
+    if zone.Name == "" || len(zone.Masters) == 0 {
+        writeError(w, http.StatusBadRequest, "Zone name and masters are required")
+        return
+    }
+    err = validateZone(zone); if err != nil {
+        writeError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    action, err := store.AddZone(zone); if err != nil {
+        a.logChange(name, zone.Name, handler.ACTION_ERROR, err)
+        writeError(w, http.StatusInternalServerError, err.Error())
+        return
+    }
+    a.logChange(name, zone.Name, action, nil)
+    if action != handler.ACTION_UNCHANGED {
+        a.sendEvent(r, name, zone, action)
+    }
+
+    status := http.StatusOK
+    if action == handler.ACTION_ADDED {
+        status = http.StatusCreated
+    }
+    writeJSON(w, status, map[string]interface{}{"action": action, "zone": zone})
+}
+
+// Remove the zone zoneName from the handler name.
+func (a *API) remove(w http.ResponseWriter, r *http.Request, name, zoneName string) {
+    store := a.store(w, name); if store == nil {
+        return
+    }
+
+    // Remember the zone's masters for the webhooks
+    removed := &bind.Zone{Name: zoneName}
+    zones, err := store.Zones(); if err != nil {
+        writeError(w, http.StatusInternalServerError, err.Error())
+        return
+    }
+    for _, zone := range zones {
+        if zone.Name == zoneName {
+            removed = zone
+        }
+    }
+
+    action, err := store.RemoveZone(zoneName); if err != nil {
+        a.logChange(name, zoneName, handler.ACTION_ERROR, err)
+        writeError(w, http.StatusInternalServerError, err.Error())
+        return
+    }
+    if action == handler.ACTION_UNCHANGED {
+        writeError(w, http.StatusNotFound, fmt.Sprintf("No such zone: %s", zoneName))
+        return
+    }
+    a.logChange(name, zoneName, action, nil)
+    a.sendEvent(r, name, removed, action)
+    err = a.state.Delete(zoneName); if err != nil {
+        a.log.Warningf("Failed to forget state of %s: %s", zoneName, err)
+    }
+    writeJSON(w, http.StatusOK, map[string]interface{}{"action": action})
+}
+
+// Normalize the name of a zone sent by a client and check that all of its data is valid.
+func validateZone(zone *bind.Zone) error {
+    name, err := bind.NormalizeZoneName(zone.Name); if err != nil {
+        return err
+    }
+    zone.Name = name
+
+    for _, m := range zone.Masters {
+        err := m.Validate(); if err != nil {
+            return err
+        }
+    }
+    err = bind.ValidateFile(zone.File); if err != nil {
+        return err
+    }
+    return zone.Options.Validate()
+}
+
+// Get the zone store for the handler name. If there is none, an error is written and nil returned.
+func (a *API) store(w http.ResponseWriter, name string) handler.ZoneStore {
+    store, ok := a.stores[name]; if !ok {
+        writeError(w, http.StatusNotFound, fmt.Sprintf("No such handler: %s", name))
+        return nil
+    }
+    return store
+}
+
+// Log a change of the zone set made through the API.
+func (a *API) logChange(name, zoneName string, action handler.Action, err error) {
+    fields := config.Fields{"handler": name, "zone": zoneName, "action": action, "source": "api"}
+    if err != nil {
+        fields["error"] = err.Error()
+        a.log.Error(config.NewEvent("Zone change via API failed", fields))
+        return
+    }
+    a.log.Info(config.NewEvent("Zone changed via API", fields))
+}
+
+// Report a change of zone in the handler name, requested by r, to the webhooks.
+func (a *API) sendEvent(r *http.Request, name string, zone *bind.Zone, action handler.Action) {
+    remote, _, err := net.SplitHostPort(r.RemoteAddr); if err != nil {
+        remote = r.RemoteAddr
+    }
+    a.hooks.Send(webhook.Event{Zone: zone.Name, Masters: zone.Masters, Handler: name, Action: string(action),
+        Timestamp: time.Now().UTC(), Remote: remote})
+}
+
+// Write data as JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(data)
+}
+
+// Write an error response with the given status code.
+func writeError(w http.ResponseWriter, status int, msg string) {
+    writeJSON(w, status, map[string]string{"error": msg})
+}
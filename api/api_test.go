@@ -0,0 +1,170 @@
+package api
+
+import (
+    "strings"
+    "testing"
+    "io/ioutil"
+    "path/filepath"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+
+    "github.com/op/go-logging"
+
+    "github.com/mandrakey/dnsync/bind"
+    "github.com/mandrakey/dnsync/config"
+    "github.com/mandrakey/dnsync/handler"
+    "github.com/mandrakey/dnsync/state"
+)
+
+const testToken = "secret"
+
+// Create an API for a single bind handler writing to a temporary directory.
+func testAPI(t *testing.T) *API {
+    dir := t.TempDir()
+    log := logging.MustGetLogger("test")
+    log.SetBackend(logging.AddModuleLevel(logging.NewLogBackend(ioutil.Discard, "", 0)))
+
+    h, err := handler.New(config.Handler{
+        Name: "bind",
+        Type: handler.HANDLER_BIND,
+        BindHandler: config.BindHandler{
+            BindConfigFile: filepath.Join(dir, "dnsync.conf"),
+            BindZonefilesPath: dir,
+        },
+    }, log)
+    if err != nil {
+        t.Fatalf("Failed to create handler: %s", err)
+    }
+    return New([]handler.Handler{h}, state.NewMemoryStore(), nil, testToken, log)
+}
+
+// Send a request to a and return the recorded response.
+func request(a *API, method, path, body, token string) *httptest.ResponseRecorder {
+    r := httptest.NewRequest(method, path, strings.NewReader(body))
+    if token != "" {
+        r.Header.Set("Authorization", "Bearer " + token)
+    }
+    w := httptest.NewRecorder()
+    a.ServeHTTP(w, r)
+    return w
+}
+
+func TestAPIUnauthorized(t *testing.T) {
+    a := testAPI(t)
+
+    if w := request(a, "GET", "/zones", "", ""); w.Code != http.StatusUnauthorized {
+        t.Fatalf("Request without token got status %d", w.Code)
+    }
+    if w := request(a, "GET", "/zones", "", "wrong"); w.Code != http.StatusUnauthorized {
+        t.Fatalf("Request with wrong token got status %d", w.Code)
+    }
+
+    r := httptest.NewRequest("GET", "/zones", nil)
+    r.Header.Set("Authorization", testToken)
+    w := httptest.NewRecorder()
+    a.ServeHTTP(w, r)
+    if w.Code != http.StatusUnauthorized {
+        t.Fatalf("Request with token but without Bearer scheme got status %d", w.Code)
+    }
+}
+
+func TestAPIEmptyTokenDeniesAll(t *testing.T) {
+    a := testAPI(t)
+    a.token = ""
+
+    if w := request(a, "GET", "/zones", "", ""); w.Code != http.StatusUnauthorized {
+        t.Fatalf("Request got status %d although no token is configured", w.Code)
+    }
+}
+
+func TestAPIAddListRemove(t *testing.T) {
+    a := testAPI(t)
+
+    w := request(a, "POST", "/zones/bind", `{"name": "domain.tld", "masters": ["1.2.3.4"]}`, testToken)
+    if w.Code != http.StatusCreated {
+        t.Fatalf("Adding zone got status %d: %s", w.Code, w.Body.String())
+    }
+
+    w = request(a, "GET", "/zones", "", testToken)
+    all := make(map[string][]*bind.Zone)
+    err := json.Unmarshal(w.Body.Bytes(), &all); if err != nil {
+        t.Fatalf("Failed to decode zone list: %s", err)
+    }
+    if len(all["bind"]) != 1 || all["bind"][0].Name != "domain.tld" {
+        t.Fatalf("Added zone not listed: %s", w.Body.String())
+    }
+
+    w = request(a, "GET", "/zones/bind/domain.tld", "", testToken)
+    zone := &bind.Zone{}
+    json.Unmarshal(w.Body.Bytes(), zone)
+    if w.Code != http.StatusOK || zone.File == "" {
+        t.Fatalf("Showing zone got status %d: %s", w.Code, w.Body.String())
+    }
+
+    w = request(a, "DELETE", "/zones/bind/domain.tld", "", testToken)
+    if w.Code != http.StatusOK {
+        t.Fatalf("Removing zone got status %d: %s", w.Code, w.Body.String())
+    }
+
+    w = request(a, "DELETE", "/zones/bind/domain.tld", "", testToken)
+    if w.Code != http.StatusNotFound {
+        t.Fatalf("Removing zone twice got status %d", w.Code)
+    }
+
+    w = request(a, "GET", "/zones/bind", "", testToken)
+    if strings.TrimSpace(w.Body.String()) != "[]" {
+        t.Fatalf("Zone list not empty after removal: %s", w.Body.String())
+    }
+}
+
+func TestAPIZoneNamesInPath(t *testing.T) {
+    a := testAPI(t)
+
+    for _, name := range []string{"0/25.2.0.192.in-addr.arpa", "example.com"} {
+        w := request(a, "POST", "/zones/bind", `{"name": "` + name + `", "masters": ["1.2.3.4"]}`, testToken)
+        if w.Code != http.StatusCreated {
+            t.Fatalf("Adding zone %s got status %d: %s", name, w.Code, w.Body.String())
+        }
+    }
+
+    for _, path := range []string{"/zones/bind/0%2F25.2.0.192.in-addr.arpa", "/zones/bind/Example.COM."} {
+        if w := request(a, "GET", path, "", testToken); w.Code != http.StatusOK {
+            t.Fatalf("Showing %s got status %d: %s", path, w.Code, w.Body.String())
+        }
+        if w := request(a, "DELETE", path, "", testToken); w.Code != http.StatusOK {
+            t.Fatalf("Removing %s got status %d: %s", path, w.Code, w.Body.String())
+        }
+    }
+
+    if w := request(a, "GET", "/zones/bind/-invalid.tld", "", testToken); w.Code != http.StatusBadRequest {
+        t.Fatalf("Invalid zone name got status %d", w.Code)
+    }
+}
+
+func TestAPIInvalidRequests(t *testing.T) {
+    a := testAPI(t)
+
+    if w := request(a, "GET", "/zones/nope", "", testToken); w.Code != http.StatusNotFound {
+        t.Fatalf("Unknown handler got status %d", w.Code)
+    }
+    if w := request(a, "POST", "/zones/bind", `{"name": "domain.tld"}`, testToken); w.Code != http.StatusBadRequest {
+        t.Fatalf("Zone without masters got status %d", w.Code)
+    }
+    if w := request(a, "POST", "/zones/bind", `not json`, testToken); w.Code != http.StatusBadRequest {
+        t.Fatalf("Invalid JSON got status %d", w.Code)
+    }
+    for _, body := range []string{
+        `{"name": "../../etc/passwd", "masters": ["1.2.3.4"]}`,
+        `{"name": "domain.tld\" { type master; }; zone \"x", "masters": ["1.2.3.4"]}`,
+        `{"name": "domain.tld", "masters": [{"address": "1.2.3.4; };"}]}`,
+        `{"name": "domain.tld", "masters": ["1.2.3.4"], "file": "db\"; };"}`,
+    } {
+        if w := request(a, "POST", "/zones/bind", body, testToken); w.Code != http.StatusBadRequest {
+            t.Fatalf("Unsafe zone %s got status %d", body, w.Code)
+        }
+    }
+    if w := request(a, "PUT", "/zones/bind", "", testToken); w.Code != http.StatusMethodNotAllowed {
+        t.Fatalf("PUT got status %d", w.Code)
+    }
+}
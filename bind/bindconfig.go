@@ -7,26 +7,23 @@
 package bind
 
 import (
+    "io"
     "os"
     "fmt"
-    "bufio"
-    "regexp"
+    "sort"
+    "time"
+    "bytes"
     "strings"
+    "path/filepath"
 )
 
 // Represents a bind zone config file containing one or more zones.
 type BindConfig struct {
     zones map[string]*Zone
+    // Zone names in the order they appear in the file
+    order []string
 }
 
-var (
-    rxZone = regexp.MustCompile("^zone \"(.+)\" \\{")
-    rxEnd = regexp.MustCompile("\\};")
-    rxMastersBegin = regexp.MustCompile("masters \\{")
-    rxFile = regexp.MustCompile("file \"(.+)\";")
-    rxMaster = regexp.MustCompile("(\\S+);")
-)
-
 // Creates a new empty BindConfig instance and returns a pointer to it.
 func NewBindConfig() *BindConfig {
     return &BindConfig{zones: make(map[string]*Zone)}
@@ -38,58 +35,140 @@ func (bc *BindConfig) Load(file string) error {
         return fmt.Errorf("The given file %s does not exist.\n", file)
     }
 
-    bc.zones = make(map[string]*Zone)
     f, err := os.Open(file); if err != nil {
         return fmt.Errorf("Failed to open file: %s\n", err)
     }
+    defer f.Close()
 
-    scanner := bufio.NewScanner(f)
-    for scanner.Scan() {
-        line := scanner.Text()
+    err = bc.Read(f); if err != nil {
+        return fmt.Errorf("Failed to parse %s: %s\n", file, err)
+    }
+    return nil
+}
 
-        m := rxZone.FindStringSubmatch(line)
-        if len(m) == 0 {
-            continue
-        }
+// Read a BindConfig from bind configuration data and store it in the current instance. All zone statements are
+// read regardless of their type, including those inside of views. Other statements are ignored.
+func (bc *BindConfig) Read(r io.Reader) error {
+    stmts, err := parseStatements(newTokenizer(r), false); if err != nil {
+        return err
+    }
 
-        zone := bc.parseZone(scanner, m[1])
-        bc.zones[zone.Name] = zone
+    bc.zones = make(map[string]*Zone)
+    bc.order = nil
+    return bc.addZoneStatements(stmts)
+}
+
+// Add the zones of all zone statements in stmts, descending into views.
+func (bc *BindConfig) addZoneStatements(stmts []*statement) error {
+    for _, stmt := range stmts {
+        switch stmt.keyword {
+        case "zone":
+            zone, err := zoneFromStatement(stmt); if err != nil {
+                return err
+            }
+            bc.AddZone(zone)
+
+        case "view":
+            err := bc.addZoneStatements(stmt.block); if err != nil {
+                return err
+            }
+        }
     }
     return nil
 }
 
 // Save the current BindConfig instance into a specified file to become a bind configuration file. Already existing
-// files will be overwritten.
+// files will be replaced atomically: the data is written to a temporary file in the same directory which is then
+// renamed, so a failed validation or write leaves the old file untouched.
 func (bc *BindConfig) Save(file string) error {
-    f, err := os.Create(file); if err != nil {
+    buf := &bytes.Buffer{}
+    err := bc.Write(buf); if err != nil {
+        return err
+    }
+
+    mode := os.FileMode(0644)
+    info, err := os.Stat(file); if err == nil {
+        mode = info.Mode().Perm()
+    }
+
+    f, err := os.CreateTemp(filepath.Dir(file), "." + filepath.Base(file) + ".*"); if err != nil {
         return fmt.Errorf("Failed to open file: %s\n", err)
     }
+    tmp := f.Name()
+    defer os.Remove(tmp)
 
-    for _, zone := range bc.zones {
-        f.WriteString(fmt.Sprintf("zone \"%s\" {\n", zone.Name))
-        f.WriteString("        type slave;\n")
-        f.WriteString("        masters {\n")
+    _, err = f.Write(buf.Bytes()); if err == nil {
+        err = f.Chmod(mode)
+    }
+    if err == nil {
+        err = f.Sync()
+    }
+    if cerr := f.Close(); err == nil {
+        err = cerr
+    }
+    if err != nil {
+        return fmt.Errorf("Failed to write file: %s\n", err)
+    }
+
+    err = os.Rename(tmp, file); if err != nil {
+        return fmt.Errorf("Failed to replace file: %s\n", err)
+    }
+    return nil
+}
+
+// Write the current BindConfig instance as bind configuration data to w. The time a zone was added is kept in a
+// dnsync comment preceding the zone statement. Nothing is written if any zone fails validation, so no data can
+// break out of its statement.
+func (bc *BindConfig) Write(w io.Writer) error {
+    buf := &bytes.Buffer{}
+    for _, name := range bc.order {
+        zone := bc.zones[name]
+        err := zone.Validate(); if err != nil {
+            return fmt.Errorf("Refusing to write zone %s: %s", zone.Name, err)
+        }
+        if !zone.AddedAt.IsZero() {
+            buf.WriteString(fmt.Sprintf("// %s%s=%s\n", metaPrefix, META_ADDED_AT, zone.AddedAt.UTC().Format(time.RFC3339)))
+        }
+        buf.WriteString(fmt.Sprintf("zone \"%s\" {\n", zone.Name))
+        buf.WriteString("        type slave;\n")
+        buf.WriteString("        masters {\n")
 
         for _, m := range zone.Masters {
-            f.WriteString(fmt.Sprintf("                %s;\n", m))
+            buf.WriteString(fmt.Sprintf("                %s;\n", m))
         }
 
-        f.WriteString("                };\n")
-        f.WriteString(fmt.Sprintf("        file \"%s\";\n", zone.File))
-        f.WriteString("};\n")
+        buf.WriteString("                };\n")
+        buf.WriteString(fmt.Sprintf("        file \"%s\";\n", zone.File))
+        zone.Options.write(buf)
+        buf.WriteString("};\n")
     }
 
-    return nil
+    _, err := w.Write(buf.Bytes())
+    return err
 }
 
-// Adds a given zone to the current BindConfig. Already existing zones will be replaced.
+// Adds a given zone to the current BindConfig. Already existing zones will be replaced in place, new zones are
+// appended.
 func (bc *BindConfig) AddZone(zone *Zone) {
+    if _, ok := bc.zones[zone.Name]; !ok {
+        bc.order = append(bc.order, zone.Name)
+    }
     bc.zones[zone.Name] = zone
 }
 
 // Remove a given zone from the current BindConfig, if it contains the zone.
 func (bc *BindConfig) RemoveZone(zone *Zone) {
+    if _, ok := bc.zones[zone.Name]; !ok {
+        return
+    }
+
     delete(bc.zones, zone.Name)
+    for i, name := range bc.order {
+        if name == zone.Name {
+            bc.order = append(bc.order[:i], bc.order[i+1:]...)
+            break
+        }
+    }
 }
 
 // Retrieve the zone instance for a given domain name from this BindConfig.
@@ -100,17 +179,28 @@ func (bc *BindConfig) GetZone(name string) *Zone {
     return CopyZone(o)
 }
 
+// Retrieve copies of all zones in this BindConfig, sorted by name.
+func (bc *BindConfig) Zones() []*Zone {
+    res := make([]*Zone, 0, len(bc.zones))
+    for _, zone := range bc.zones {
+        res = append(res, CopyZone(zone))
+    }
+    sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+    return res
+}
+
 // Create a string representation of this BindConfig instance.
 func (bc *BindConfig) String() string {
     res := make([]string, 0)
 
-    for _, zone := range bc.zones {
+    for _, name := range bc.order {
+        zone := bc.zones[name]
         res = append(
             res,
             fmt.Sprintf(
                 "Zone = { name: '%s', masters: [ %s ], file: \"%s\" };\n",
                 zone.Name,
-                strings.Join(zone.Masters, ", "),
+                JoinMasters(zone.Masters, ", "),
                 zone.File,
             ),
         )
@@ -119,44 +209,6 @@ func (bc *BindConfig) String() string {
     return strings.Join(res, "")
 }
 
-// Parses given data from scanner and stores the information in this BindConfig.
-func (bc *BindConfig) parseZone(scanner *bufio.Scanner, name string) *Zone {
-    z := Zone{Name: name}
-
-    inMasters := false
-    for scanner.Scan() {
-        line := scanner.Text()
-
-        if rxEnd.MatchString(line) {
-            if inMasters {
-                inMasters = false
-            } else {
-                return &z
-            }
-        }
-
-        if !inMasters && rxMastersBegin.MatchString(line) {
-            inMasters = true
-            continue
-        }
-
-        if !inMasters && rxFile.MatchString(line) {
-            m := rxFile.FindStringSubmatch(line)
-            z.File = strings.TrimSpace(m[1])
-        }
-
-        if inMasters {
-            m := rxMaster.FindStringSubmatch(line)
-            if len(m) == 0 {
-                continue
-            }
-            z.Masters = append(z.Masters, strings.TrimSpace(m[1]))
-        }
-    }
-
-    return &z
-}
-
 // Check whether or not this BindConfig is the same as other.
 func (bc *BindConfig) Equals(other *BindConfig) bool {
     matches := make(map[string]bool)
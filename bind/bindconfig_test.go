@@ -1,7 +1,12 @@
 package bind
 
 import (
+    "os"
+    "time"
+    "bytes"
+    "strings"
     "testing"
+    "path/filepath"
 )
 
 func TestBindConfigLoad(t *testing.T) {
@@ -40,8 +45,8 @@ func TestBindConfigSave(t *testing.T) {
 func TestBindConfigAddZone(t *testing.T) {
     bc := NewBindConfig()
     bc2 := NewBindConfig()
-    z1 := &Zone{Name: "domain.tld", Masters: []string{"1.2.3.4"}, File: "somefile"}
-    //z2 := &Zone{Name: "domain2.tld", Masters: []string{"1.2.3.4"}, File: "somefile"}
+    z1 := &Zone{Name: "domain.tld", Masters: MastersFrom("1.2.3.4"), File: "somefile"}
+    //z2 := &Zone{Name: "domain2.tld", Masters: MastersFrom("1.2.3.4"), File: "somefile"}
 
     bc.AddZone(z1)
     if bc.Equals(bc2) {
@@ -57,7 +62,7 @@ func TestBindConfigAddZone(t *testing.T) {
 func TestBindConfigRemoveZone(t *testing.T) {
     bc := NewBindConfig()
     bc2 := NewBindConfig()
-    z1 := &Zone{Name: "domain.tld", Masters: []string{"1.2.3.4"}, File: "somefile"}
+    z1 := &Zone{Name: "domain.tld", Masters: MastersFrom("1.2.3.4"), File: "somefile"}
 
     bc.AddZone(z1)
     if bc.Equals(bc2) {
@@ -72,7 +77,7 @@ func TestBindConfigRemoveZone(t *testing.T) {
 
 func TestBindConfigGetZone(t *testing.T) {
     bc := NewBindConfig()
-    z1 := &Zone{Name: "domain.tld", Masters: []string{"1.2.3.4"}, File: "somefile"}
+    z1 := &Zone{Name: "domain.tld", Masters: MastersFrom("1.2.3.4"), File: "somefile"}
     bc.AddZone(z1)
 
     z := bc.GetZone(z1.Name)
@@ -85,12 +90,85 @@ func TestBindConfigEquals(t *testing.T) {
     bc := NewBindConfig()
     bc2 := NewBindConfig()
 
-    bc.AddZone(&Zone{Name: "domain.tld", Masters: []string{"1.2.3.4"}, File: "somefile"})
-    bc.AddZone(&Zone{Name: "domain2.tld", Masters: []string{"1.2.3.4"}, File: "somefile"})
-    bc2.AddZone(&Zone{Name: "domain2.tld", Masters: []string{"1.2.3.4"}, File: "somefile"})
-    bc2.AddZone(&Zone{Name: "domain.tld", Masters: []string{"1.2.3.4"}, File: "somefile"})
+    bc.AddZone(&Zone{Name: "domain.tld", Masters: MastersFrom("1.2.3.4"), File: "somefile"})
+    bc.AddZone(&Zone{Name: "domain2.tld", Masters: MastersFrom("1.2.3.4"), File: "somefile"})
+    bc2.AddZone(&Zone{Name: "domain2.tld", Masters: MastersFrom("1.2.3.4"), File: "somefile"})
+    bc2.AddZone(&Zone{Name: "domain.tld", Masters: MastersFrom("1.2.3.4"), File: "somefile"})
 
     if !bc.Equals(bc2) {
         t.Fatal("BindConfig instances based off the same file are not equal")
     }
 }
+
+func TestBindConfigZones(t *testing.T) {
+    bc := NewBindConfig()
+    bc.AddZone(&Zone{Name: "domain2.tld", Masters: MastersFrom("1.2.3.4"), File: "somefile"})
+    bc.AddZone(&Zone{Name: "domain.tld", Masters: MastersFrom("1.2.3.4"), File: "somefile"})
+
+    zones := bc.Zones()
+    if len(zones) != 2 {
+        t.Fatalf("Expected 2 zones, got %d", len(zones))
+    }
+    if zones[0].Name != "domain.tld" || zones[1].Name != "domain2.tld" {
+        t.Fatal("zones are not sorted by name")
+    }
+}
+
+func TestBindConfigAddedAt(t *testing.T) {
+    added := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+    bc := NewBindConfig()
+    bc.AddZone(&Zone{Name: "domain.tld", Masters: MastersFrom("1.2.3.4"), File: "somefile", AddedAt: added})
+    bc.AddZone(&Zone{Name: "domain2.tld", Masters: MastersFrom("1.2.3.4"), File: "somefile"})
+
+    buf := &bytes.Buffer{}
+    bc.Write(buf)
+    if !strings.HasPrefix(buf.String(), "// dnsync:added-at=2018-05-01T12:00:00Z\nzone \"domain.tld\" {\n") {
+        t.Fatalf("added-at comment not written:\n%s", buf.String())
+    }
+
+    bc2 := NewBindConfig()
+    err := bc2.Read(buf); if err != nil {
+        t.Fatalf("Failed to read written config: %s", err)
+    }
+    if !bc2.GetZone("domain.tld").AddedAt.Equal(added) {
+        t.Fatalf("added-at not read back: %s", bc2.GetZone("domain.tld").AddedAt)
+    }
+    if !bc2.GetZone("domain2.tld").AddedAt.IsZero() {
+        t.Fatal("added-at of second zone should be unknown")
+    }
+}
+
+func TestBindConfigSaveFailureKeepsFile(t *testing.T) {
+    file := filepath.Join(t.TempDir(), "zones.conf")
+    orig := "zone \"local.tld\" {\n        type master;\n        file \"/etc/bind/db.local.tld\";\n};\n"
+    err := os.WriteFile(file, []byte(orig), 0640); if err != nil {
+        t.Fatal(err)
+    }
+
+    bc := NewBindConfig()
+    err = bc.Load(file); if err != nil {
+        t.Fatalf("Failed to load config: %s", err)
+    }
+    bc.AddZone(&Zone{Name: "domain.tld", Masters: MastersFrom("1.2.3.4"), File: "somefile"})
+    err = bc.Save(file); if err == nil || !strings.Contains(err.Error(), "Refusing to write zone local.tld") {
+        t.Fatalf("Save should refuse the zone without masters, got: %v", err)
+    }
+
+    data, _ := os.ReadFile(file)
+    if string(data) != orig {
+        t.Fatalf("Failed save modified the file:\n%s", data)
+    }
+    entries, _ := os.ReadDir(filepath.Dir(file))
+    if len(entries) != 1 {
+        t.Fatalf("Temporary files left behind: %d entries", len(entries))
+    }
+
+    bc.RemoveZone(bc.GetZone("local.tld"))
+    err = bc.Save(file); if err != nil {
+        t.Fatalf("Failed to save config: %s", err)
+    }
+    info, _ := os.Stat(file)
+    if info.Mode().Perm() != 0640 {
+        t.Fatalf("File mode not kept: %s", info.Mode())
+    }
+}
@@ -0,0 +1,133 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package bind
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "encoding/json"
+)
+
+// A master of a zone, which zone transfers are requested from.
+type Master struct {
+    Address string `json:"address"`
+    // Port to request zone transfers on, 0 for the default
+    Port int `json:"port,omitempty"`
+    // Name of the TSIG key signing zone transfers, empty for none. The key must be defined in the bind configuration.
+    Key string `json:"key,omitempty"`
+}
+
+// Create masters with default port and no key from a list of addresses.
+func MastersFrom(addresses ...string) []Master {
+    res := make([]Master, 0, len(addresses))
+    for _, a := range addresses {
+        res = append(res, Master{Address: a})
+    }
+    return res
+}
+
+// Parse a master given in bind syntax, e.g. `10.0.0.1 port 5353 key "transfer"`.
+func ParseMaster(s string) (Master, error) {
+    fields := strings.Fields(s)
+    if len(fields) == 0 {
+        return Master{}, fmt.Errorf("Empty master")
+    }
+    return masterFromArgs(fields[0], fields[1:])
+}
+
+// Build a Master from its address and the arguments following it in a bind masters list.
+func masterFromArgs(address string, args []string) (Master, error) {
+    m := Master{Address: address}
+    if len(args) % 2 != 0 {
+        return m, fmt.Errorf("Invalid master %s: incomplete clause %s", address, args[len(args) - 1])
+    }
+
+    for i := 0; i < len(args); i += 2 {
+        switch args[i] {
+        case "port":
+            port, err := strconv.Atoi(args[i + 1]); if err != nil || port < 1 || port > 65535 {
+                return m, fmt.Errorf("Invalid port of master %s: %s", address, args[i + 1])
+            }
+            m.Port = port
+
+        case "key":
+            m.Key = strings.Trim(args[i + 1], "\"")
+
+        default:
+            return m, fmt.Errorf("Invalid master %s: unknown clause %s", address, args[i])
+        }
+    }
+    return m, nil
+}
+
+// Create the bind syntax of this Master, as used in masters lists.
+func (m Master) String() string {
+    res := m.Address
+    if m.Port != 0 {
+        res += fmt.Sprintf(" port %d", m.Port)
+    }
+    if m.Key != "" {
+        res += fmt.Sprintf(" key \"%s\"", m.Key)
+    }
+    return res
+}
+
+// Unmarshal a Master from JSON, given either as object or as string in bind syntax.
+func (m *Master) UnmarshalJSON(data []byte) error {
+    var s string
+    if json.Unmarshal(data, &s) == nil {
+        res, err := ParseMaster(s); if err != nil {
+            return err
+        }
+        *m = res
+        return nil
+    }
+
+    // Decode into a type without this method to avoid recursion
+    type plainMaster Master
+    res := plainMaster{}
+    err := json.Unmarshal(data, &res); if err != nil {
+        return err
+    }
+    *m = Master(res)
+    return nil
+}
+
+// Check whether or not masters contains m.
+func HasMaster(masters []Master, m Master) bool {
+    for _, o := range masters {
+        if o == m {
+            return true
+        }
+    }
+    return false
+}
+
+// Check whether or not a and b contain the same masters, regardless of their order.
+func SameMasters(a, b []Master) bool {
+    for _, m := range a {
+        if !HasMaster(b, m) {
+            return false
+        }
+    }
+    for _, m := range b {
+        if !HasMaster(a, m) {
+            return false
+        }
+    }
+    return true
+}
+
+// Join the bind syntax of masters with sep.
+func JoinMasters(masters []Master, sep string) string {
+    res := make([]string, 0, len(masters))
+    for _, m := range masters {
+        res = append(res, m.String())
+    }
+    return strings.Join(res, sep)
+}
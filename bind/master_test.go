@@ -0,0 +1,74 @@
+package bind
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+    "encoding/json"
+)
+
+func TestParseMaster(t *testing.T) {
+    tests := []struct {
+        in string
+        expect Master
+        err bool
+    }{
+        {"10.0.0.1", Master{Address: "10.0.0.1"}, false},
+        {"10.0.0.1 port 5353", Master{Address: "10.0.0.1", Port: 5353}, false},
+        {"10.0.0.1 port 5353 key \"xfr\"", Master{Address: "10.0.0.1", Port: 5353, Key: "xfr"}, false},
+        {"10.0.0.1 key xfr", Master{Address: "10.0.0.1", Key: "xfr"}, false},
+        {"", Master{}, true},
+        {"10.0.0.1 port", Master{}, true},
+        {"10.0.0.1 port 70000", Master{}, true},
+        {"10.0.0.1 dscp 1", Master{}, true},
+    }
+
+    for _, test := range tests {
+        m, err := ParseMaster(test.in)
+        if (err != nil) != test.err || (err == nil && m != test.expect) {
+            t.Errorf("ParseMaster(%q) = %+v, %v", test.in, m, err)
+        }
+    }
+}
+
+func TestMasterString(t *testing.T) {
+    m := Master{Address: "10.0.0.1", Port: 5353, Key: "xfr"}
+    if m.String() != "10.0.0.1 port 5353 key \"xfr\"" {
+        t.Fatalf("Master string output is wrong: %s", m.String())
+    }
+    if (Master{Address: "10.0.0.1"}).String() != "10.0.0.1" {
+        t.Fatalf("Master string output without clauses is wrong")
+    }
+}
+
+func TestMasterUnmarshalJSON(t *testing.T) {
+    var masters []Master
+    err := json.Unmarshal([]byte(`["10.0.0.1 port 53", {"address": "10.0.0.2", "key": "xfr"}]`), &masters); if err != nil {
+        t.Fatalf("Failed to unmarshal masters: %s", err)
+    }
+    if len(masters) != 2 || masters[0] != (Master{Address: "10.0.0.1", Port: 53}) ||
+            masters[1] != (Master{Address: "10.0.0.2", Key: "xfr"}) {
+        t.Fatalf("Masters not unmarshalled correctly: %+v", masters)
+    }
+}
+
+func TestMasterRoundTrip(t *testing.T) {
+    bc := NewBindConfig()
+    zone := &Zone{Name: "domain.tld", Masters: []Master{{Address: "10.0.0.1", Port: 5353, Key: "xfr"}, {Address: "10.0.0.2"}},
+        File: "db.domain.tld"}
+    bc.AddZone(zone)
+
+    buf := &bytes.Buffer{}
+    bc.Write(buf)
+    if !strings.Contains(buf.String(), "10.0.0.1 port 5353 key \"xfr\";\n") {
+        t.Fatalf("Master clauses not written:\n%s", buf.String())
+    }
+
+    bc2 := NewBindConfig()
+    err := bc2.Read(buf); if err != nil {
+        t.Fatalf("Failed to read written config: %s", err)
+    }
+    if z := bc2.GetZone("domain.tld"); z == nil || !z.Equals(zone) {
+        t.Fatalf("Zone with master clauses not read back correctly: %v", z)
+    }
+}
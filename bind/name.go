@@ -0,0 +1,101 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package bind
+
+import (
+    "fmt"
+    "net"
+    "strings"
+
+    "golang.org/x/net/idna"
+)
+
+// Limits of domain names, see RFC 1035. The name length excludes the trailing dot.
+const (
+    MAX_NAME_LENGTH = 253
+    MAX_LABEL_LENGTH = 63
+)
+
+// Suffixes of reverse zones, whose labels may contain a slash for classless delegation (RFC 2317).
+var reverseSuffixes = []string{".in-addr.arpa", ".ip6.arpa"}
+
+// Bring a zone name into the form dnsync stores it in: without trailing dot, lower case and IDNs in their ASCII
+// form. Returns an error if the result is no valid zone name.
+func NormalizeZoneName(name string) (string, error) {
+    name = strings.ToLower(strings.TrimSuffix(name, "."))
+    ascii, err := idna.ToASCII(name); if err != nil {
+        return "", fmt.Errorf("Invalid zone name %q: %s", name, err)
+    }
+    return ascii, ValidateZoneName(ascii)
+}
+
+// Check that name is a zone name which is safe to write into bind configuration files and to build file paths
+// from: at most 253 characters in labels of 1 to 63 letters, digits, dashes and underscores, with dashes neither
+// leading nor trailing. Reverse zones may also contain slashes. A trailing dot is not allowed.
+func ValidateZoneName(name string) error {
+    reverse := false
+    for _, suffix := range reverseSuffixes {
+        reverse = reverse || strings.HasSuffix(strings.ToLower(name), suffix)
+    }
+    return validateName(name, reverse)
+}
+
+// Check that name is a domain name with labels of letters, digits, dashes and underscores, and slashes if
+// allowSlash is set.
+func validateName(name string, allowSlash bool) error {
+    if name == "" {
+        return fmt.Errorf("Empty name")
+    }
+    if len(name) > MAX_NAME_LENGTH {
+        return fmt.Errorf("Name %.20q... is longer than %d characters", name, MAX_NAME_LENGTH)
+    }
+
+    for _, label := range strings.Split(name, ".") {
+        if label == "" {
+            return fmt.Errorf("Name %q contains an empty label", name)
+        }
+        if len(label) > MAX_LABEL_LENGTH {
+            return fmt.Errorf("Label %.20q... of %q is longer than %d characters", label, name, MAX_LABEL_LENGTH)
+        }
+        if label[0] == '-' || label[len(label) - 1] == '-' {
+            return fmt.Errorf("Label %q of %q starts or ends with a dash", label, name)
+        }
+        for _, c := range []byte(label) {
+            if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' ||
+                    c == '/' && allowSlash) {
+                return fmt.Errorf("Name %q contains invalid character %q", name, c)
+            }
+        }
+    }
+    return nil
+}
+
+// Check that a master is safe to write into bind configuration files: its address must be an IP address or the
+// name of a masters list, its key a valid key name.
+func (m Master) Validate() error {
+    if net.ParseIP(m.Address) == nil {
+        err := validateName(m.Address, false); if err != nil {
+            return fmt.Errorf("Invalid master address: %s", err)
+        }
+    }
+    if m.Key != "" {
+        err := validateName(m.Key, false); if err != nil {
+            return fmt.Errorf("Invalid key of master %s: %s", m.Address, err)
+        }
+    }
+    return nil
+}
+
+// Check that a file path is safe to write into bind configuration files as quoted string.
+func ValidateFile(file string) error {
+    for _, c := range []byte(file) {
+        if c == '"' || c == '\\' || c < 0x20 || c == 0x7f {
+            return fmt.Errorf("File %q contains invalid character %q", file, c)
+        }
+    }
+    return nil
+}
@@ -0,0 +1,89 @@
+package bind
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+)
+
+func TestValidateZoneName(t *testing.T) {
+    valid := []string{
+        "domain.tld",
+        "sub-domain.Domain.tld",
+        "_dmarc.domain.tld",
+        "xn--bcher-kva.example",
+        "2.0.192.in-addr.arpa",
+        "0/25.2.0.192.in-addr.arpa",
+        strings.Repeat("a", 63) + ".tld",
+    }
+    invalid := []string{
+        "",
+        "domain.tld.",
+        ".domain.tld",
+        "domain..tld",
+        "../etc/passwd",
+        "domain/tld",
+        "-domain.tld",
+        "domain-.tld",
+        "domain.tld\" { type master; }; zone \"x",
+        "domain tld",
+        "domain;tld",
+        "bücher.example",
+        strings.Repeat("a", 64) + ".tld",
+        strings.Repeat("a.", 127) + "tld",
+    }
+
+    for _, name := range valid {
+        if err := ValidateZoneName(name); err != nil {
+            t.Errorf("Valid name %q rejected: %s", name, err)
+        }
+    }
+    for _, name := range invalid {
+        if ValidateZoneName(name) == nil {
+            t.Errorf("Invalid name %q accepted", name)
+        }
+    }
+}
+
+func TestNormalizeZoneName(t *testing.T) {
+    tests := map[string]string{
+        "Domain.TLD.": "domain.tld",
+        "bücher.example": "xn--bcher-kva.example",
+        "0/25.2.0.192.IN-ADDR.ARPA": "0/25.2.0.192.in-addr.arpa",
+    }
+    for name, expect := range tests {
+        res, err := NormalizeZoneName(name); if err != nil || res != expect {
+            t.Errorf("NormalizeZoneName(%q) = %q, %v, expected %q", name, res, err, expect)
+        }
+    }
+
+    if _, err := NormalizeZoneName("evil\".tld"); err == nil {
+        t.Error("Name with quote was normalized without error")
+    }
+}
+
+func TestZoneValidate(t *testing.T) {
+    invalid := []*Zone{
+        {Name: "domain.tld", Masters: MastersFrom("1.2.3.4; }; zone \"evil"), File: "db.domain.tld"},
+        {Name: "domain.tld", Masters: []Master{{Address: "1.2.3.4", Key: "x\"; };"}}, File: "db.domain.tld"},
+        {Name: "domain.tld", Masters: MastersFrom("1.2.3.4"), File: "db\";\n};"},
+    }
+    for _, zone := range invalid {
+        if zone.Validate() == nil {
+            t.Errorf("Invalid zone accepted: %s", zone)
+        }
+
+        bc := NewBindConfig()
+        bc.AddZone(zone)
+        buf := &bytes.Buffer{}
+        if bc.Write(buf) == nil || buf.Len() > 0 {
+            t.Errorf("Invalid zone written: %s", buf.String())
+        }
+    }
+
+    valid := &Zone{Name: "domain.tld", Masters: []Master{{Address: "2001:db8::1", Port: 53, Key: "xfr-key"},
+        {Address: "primaries"}}, File: "/var/lib/bind/db.domain.tld"}
+    if err := valid.Validate(); err != nil {
+        t.Errorf("Valid zone rejected: %s", err)
+    }
+}
@@ -0,0 +1,226 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package bind
+
+import (
+    "fmt"
+    "bytes"
+    "strings"
+
+    "github.com/mandrakey/dnsync/tools"
+)
+
+// Additional options of a zone statement. Address match lists hold their elements in bind syntax, e.g.
+// `10.0.0.0/8`, `!192.0.2.9` or `key "transfer"`. Empty fields are omitted.
+type ZoneOptions struct {
+    AllowTransfer []string `json:"allow-transfer,omitempty"`
+    AlsoNotify []string `json:"also-notify,omitempty"`
+    // One of yes, no, explicit, master-only or primary-only
+    Notify string `json:"notify,omitempty"`
+    // One of text, raw or map
+    MasterfileFormat string `json:"masterfile-format,omitempty"`
+    // yes or no
+    InlineSigning string `json:"inline-signing,omitempty"`
+    // Name of a dnssec-policy defined in the bind configuration
+    DnssecPolicy string `json:"dnssec-policy,omitempty"`
+}
+
+// Allowed values of the keyword options.
+var (
+    notifyValues = []string{"yes", "no", "explicit", "master-only", "primary-only"}
+    masterfileFormats = []string{"text", "raw", "map"}
+    booleanValues = []string{"yes", "no"}
+)
+
+// Check whether or not no option is set. An empty list is an option, as it is written as an empty statement.
+func (o ZoneOptions) IsEmpty() bool {
+    return o.Equals(ZoneOptions{})
+}
+
+// Check whether or not o sets the same options as other. A list which is not set differs from an empty one.
+func (o ZoneOptions) Equals(other ZoneOptions) bool {
+    return listEquals(o.AllowTransfer, other.AllowTransfer) && listEquals(o.AlsoNotify, other.AlsoNotify) &&
+        o.Notify == other.Notify && o.MasterfileFormat == other.MasterfileFormat &&
+        o.InlineSigning == other.InlineSigning && o.DnssecPolicy == other.DnssecPolicy
+}
+
+// Check whether or not two address match lists are both unset or have the same elements in the same order.
+func listEquals(a, b []string) bool {
+    if (a == nil) != (b == nil) || len(a) != len(b) {
+        return false
+    }
+    for i := range a {
+        if a[i] != b[i] {
+            return false
+        }
+    }
+    return true
+}
+
+// Create a copy of o with all options set in other replacing those of o.
+func (o ZoneOptions) Merge(other ZoneOptions) ZoneOptions {
+    res := o.Copy()
+    if other.AllowTransfer != nil {
+        res.AllowTransfer = append([]string{}, other.AllowTransfer...)
+    }
+    if other.AlsoNotify != nil {
+        res.AlsoNotify = append([]string{}, other.AlsoNotify...)
+    }
+    if other.Notify != "" {
+        res.Notify = other.Notify
+    }
+    if other.MasterfileFormat != "" {
+        res.MasterfileFormat = other.MasterfileFormat
+    }
+    if other.InlineSigning != "" {
+        res.InlineSigning = other.InlineSigning
+    }
+    if other.DnssecPolicy != "" {
+        res.DnssecPolicy = other.DnssecPolicy
+    }
+    return res
+}
+
+// Create a deep copy of o.
+func (o ZoneOptions) Copy() ZoneOptions {
+    res := o
+    if o.AllowTransfer != nil {
+        res.AllowTransfer = append([]string{}, o.AllowTransfer...)
+    }
+    if o.AlsoNotify != nil {
+        res.AlsoNotify = append([]string{}, o.AlsoNotify...)
+    }
+    return res
+}
+
+// Check that all options have valid values which are safe to write into bind configuration files.
+func (o ZoneOptions) Validate() error {
+    for _, list := range [][]string{o.AllowTransfer, o.AlsoNotify} {
+        for _, e := range list {
+            err := validateListElement(e); if err != nil {
+                return err
+            }
+        }
+    }
+    if o.Notify != "" && !tools.StringInSlice(o.Notify, notifyValues) {
+        return fmt.Errorf("Invalid notify: %s", o.Notify)
+    }
+    if o.MasterfileFormat != "" && !tools.StringInSlice(o.MasterfileFormat, masterfileFormats) {
+        return fmt.Errorf("Invalid masterfile-format: %s", o.MasterfileFormat)
+    }
+    if o.InlineSigning != "" && !tools.StringInSlice(o.InlineSigning, booleanValues) {
+        return fmt.Errorf("Invalid inline-signing: %s", o.InlineSigning)
+    }
+    if o.DnssecPolicy != "" {
+        err := validateName(o.DnssecPolicy, false); if err != nil {
+            return fmt.Errorf("Invalid dnssec-policy: %s", err)
+        }
+    }
+    return nil
+}
+
+// Check that an address match list element consists of words of letters, digits and the characters of addresses,
+// prefixes and negations, which may be quoted.
+func validateListElement(e string) error {
+    words := strings.Fields(e)
+    if len(words) == 0 {
+        return fmt.Errorf("Empty address match list element")
+    }
+    for _, w := range words {
+        if len(w) >= 2 && w[0] == '"' && w[len(w) - 1] == '"' {
+            w = w[1:len(w) - 1]
+        }
+        if w == "" {
+            return fmt.Errorf("Invalid address match list element %q", e)
+        }
+        for _, c := range []byte(w) {
+            if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+                    strings.IndexByte(".:/!_-", c) >= 0) {
+                return fmt.Errorf("Address match list element %q contains invalid character %q", e, c)
+            }
+        }
+    }
+    return nil
+}
+
+// Write the options as statements of a zone block to buf.
+func (o ZoneOptions) write(buf *bytes.Buffer) {
+    writeList := func(keyword string, elements []string) {
+        if elements == nil {
+            return
+        }
+        buf.WriteString(fmt.Sprintf("        %s {\n", keyword))
+        for _, e := range elements {
+            buf.WriteString(fmt.Sprintf("                %s;\n", e))
+        }
+        buf.WriteString("                };\n")
+    }
+
+    writeList("allow-transfer", o.AllowTransfer)
+    writeList("also-notify", o.AlsoNotify)
+    if o.Notify != "" {
+        buf.WriteString(fmt.Sprintf("        notify %s;\n", o.Notify))
+    }
+    if o.MasterfileFormat != "" {
+        buf.WriteString(fmt.Sprintf("        masterfile-format %s;\n", o.MasterfileFormat))
+    }
+    if o.InlineSigning != "" {
+        buf.WriteString(fmt.Sprintf("        inline-signing %s;\n", o.InlineSigning))
+    }
+    if o.DnssecPolicy != "" {
+        buf.WriteString(fmt.Sprintf("        dnssec-policy \"%s\";\n", o.DnssecPolicy))
+    }
+}
+
+// Read an option statement of a zone block into o. Returns false if the statement is no supported option.
+func (o *ZoneOptions) read(s *statement) bool {
+    switch s.keyword {
+    case "allow-transfer":
+        o.AllowTransfer = listElements(s)
+    case "also-notify":
+        o.AlsoNotify = listElements(s)
+    case "notify":
+        o.Notify = firstArg(s)
+    case "masterfile-format":
+        o.MasterfileFormat = firstArg(s)
+    case "inline-signing":
+        o.InlineSigning = firstArg(s)
+    case "dnssec-policy":
+        o.DnssecPolicy = firstArg(s)
+    default:
+        return false
+    }
+    return true
+}
+
+// Get the elements of the address match list in the block of s in bind syntax.
+func listElements(s *statement) []string {
+    res := make([]string, 0, len(s.block))
+    for _, e := range s.block {
+        words := make([]string, 0, len(e.args) + 1)
+        if e.keyword != "" {
+            words = append(words, e.keyword)
+        }
+        for _, a := range e.args {
+            if a.quoted {
+                words = append(words, fmt.Sprintf("\"%s\"", a.text))
+            } else {
+                words = append(words, a.text)
+            }
+        }
+        res = append(res, strings.Join(words, " "))
+    }
+    return res
+}
+
+// Get the text of the first argument of s, or an empty string.
+func firstArg(s *statement) string {
+    if len(s.args) == 0 {
+        return ""
+    }
+    return s.args[0].text
+}
@@ -0,0 +1,96 @@
+package bind
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+)
+
+func TestZoneOptionsRoundTrip(t *testing.T) {
+    zone := &Zone{Name: "domain.tld", Masters: MastersFrom("1.2.3.4"), File: "db.domain.tld", Options: ZoneOptions{
+        AllowTransfer: []string{"key \"xfr\"", "10.0.0.0/8", "!192.0.2.9"},
+        AlsoNotify: []string{"10.0.0.1 port 5353"},
+        Notify: "no",
+        MasterfileFormat: "raw",
+        InlineSigning: "yes",
+        DnssecPolicy: "default",
+    }}
+
+    bc := NewBindConfig()
+    bc.AddZone(zone)
+    buf := &bytes.Buffer{}
+    err := bc.Write(buf); if err != nil {
+        t.Fatalf("Failed to write zone with options: %s", err)
+    }
+    for _, expect := range []string{"        notify no;\n", "        masterfile-format raw;\n",
+            "        inline-signing yes;\n", "        dnssec-policy \"default\";\n", "                key \"xfr\";\n"} {
+        if !strings.Contains(buf.String(), expect) {
+            t.Fatalf("Written zone does not contain %q:\n%s", expect, buf.String())
+        }
+    }
+
+    bc2 := NewBindConfig()
+    err = bc2.Read(buf); if err != nil {
+        t.Fatalf("Failed to read zone with options: %s", err)
+    }
+    if z := bc2.GetZone("domain.tld"); z == nil || !z.Equals(zone) {
+        t.Fatalf("Zone options did not round-trip.\nExpect: %+v\nActual: %+v", zone.Options, z)
+    }
+}
+
+func TestZoneOptionsValidate(t *testing.T) {
+    invalid := []ZoneOptions{
+        {AllowTransfer: []string{"any; }; zone \"evil\" {"}},
+        {AlsoNotify: []string{""}},
+        {Notify: "maybe"},
+        {MasterfileFormat: "binary"},
+        {InlineSigning: "true"},
+        {DnssecPolicy: "x\"; };"},
+    }
+    for _, o := range invalid {
+        if o.Validate() == nil {
+            t.Errorf("Invalid options accepted: %+v", o)
+        }
+    }
+}
+
+func TestZoneOptionsMerge(t *testing.T) {
+    defaults := ZoneOptions{AllowTransfer: []string{"none"}, Notify: "no"}
+    res := defaults.Merge(ZoneOptions{AllowTransfer: []string{"key \"xfr\""}, DnssecPolicy: "default"})
+
+    expect := ZoneOptions{AllowTransfer: []string{"key \"xfr\""}, Notify: "no", DnssecPolicy: "default"}
+    if !res.Equals(expect) {
+        t.Fatalf("Options not merged correctly: %+v", res)
+    }
+    if defaults.AllowTransfer[0] != "none" {
+        t.Fatalf("Merging changed the original options")
+    }
+    if !(ZoneOptions{}).IsEmpty() || res.IsEmpty() {
+        t.Fatalf("IsEmpty is wrong")
+    }
+}
+
+func TestZoneOptionsEmptyList(t *testing.T) {
+    empty := ZoneOptions{AllowTransfer: []string{}}
+    if empty.IsEmpty() || empty.Equals(ZoneOptions{}) || (ZoneOptions{}).Equals(empty) {
+        t.Fatal("Empty list treated like an unset one")
+    }
+    if !empty.Equals(empty.Copy()) || !empty.Equals(ZoneOptions{}.Merge(empty)) {
+        t.Fatal("Empty list lost by Copy or Merge")
+    }
+
+    bc := NewBindConfig()
+    bc.AddZone(&Zone{Name: "domain.tld", Masters: MastersFrom("1.2.3.4"), File: "db.domain.tld", Options: empty})
+    buf := &bytes.Buffer{}
+    bc.Write(buf)
+    if !strings.Contains(buf.String(), "        allow-transfer {\n                };\n") {
+        t.Fatalf("Empty list not written:\n%s", buf.String())
+    }
+    bc2 := NewBindConfig()
+    err := bc2.Read(buf); if err != nil {
+        t.Fatalf("Failed to read zone: %s", err)
+    }
+    if z := bc2.GetZone("domain.tld"); z == nil || !z.Options.Equals(empty) {
+        t.Fatalf("Empty list did not round-trip: %+v", z)
+    }
+}
@@ -0,0 +1,284 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package bind
+
+import (
+    "io"
+    "fmt"
+    "time"
+    "bufio"
+    "strings"
+)
+
+// Prefix of comments carrying dnsync metadata about the following statement, e.g. "// dnsync:added-at=...".
+const metaPrefix = "dnsync:"
+
+// Keys of metadata stored in dnsync comments.
+const (
+    META_ADDED_AT = "added-at"
+)
+
+// A single token of a bind configuration file.
+type token struct {
+    text string
+    // Whether or not the token was a quoted string
+    quoted bool
+}
+
+// Splits bind configuration data into tokens, skipping whitespace and comments in all three bind styles:
+// "// ...", "# ..." and "/* ... */".
+type tokenizer struct {
+    r *bufio.Reader
+    // Metadata from dnsync comments read since the last statement began
+    meta map[string]string
+}
+
+// Create a new tokenizer reading from r.
+func newTokenizer(r io.Reader) *tokenizer {
+    return &tokenizer{r: bufio.NewReader(r)}
+}
+
+// Get the next token. Returns io.EOF at the end of the data.
+func (t *tokenizer) token() (*token, error) {
+    for {
+        c, err := t.r.ReadByte(); if err != nil {
+            return nil, err
+        }
+
+        switch {
+        case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+            continue
+
+        case c == '#':
+            t.skipLine()
+            continue
+
+        case c == '/' && t.following('/'):
+            t.readMeta(t.skipLine())
+            continue
+
+        case c == '/' && t.following('*'):
+            err := t.skipBlockComment(); if err != nil {
+                return nil, err
+            }
+            continue
+
+        case c == '{' || c == '}' || c == ';':
+            return &token{text: string(c)}, nil
+
+        case c == '"':
+            s, err := t.r.ReadString('"'); if err != nil {
+                return nil, fmt.Errorf("Unterminated string")
+            }
+            return &token{text: strings.TrimSuffix(s, "\""), quoted: true}, nil
+
+        default:
+            word := []byte{c}
+            for {
+                c, err := t.r.ReadByte(); if err != nil {
+                    break
+                }
+                if strings.IndexByte(" \t\r\n{};\"#", c) >= 0 {
+                    t.r.UnreadByte()
+                    break
+                }
+                word = append(word, c)
+            }
+            return &token{text: string(word)}, nil
+        }
+    }
+}
+
+// Check whether or not the next byte is c and consume it if so.
+func (t *tokenizer) following(c byte) bool {
+    b, err := t.r.Peek(1); if err != nil || b[0] != c {
+        return false
+    }
+    t.r.ReadByte()
+    return true
+}
+
+// Skip everything up to and including the next line break and return the skipped text.
+func (t *tokenizer) skipLine() string {
+    s, _ := t.r.ReadString('\n')
+    return s
+}
+
+// Remember the metadata in comment, if it is a dnsync comment.
+func (t *tokenizer) readMeta(comment string) {
+    comment = strings.TrimSpace(comment)
+    if !strings.HasPrefix(comment, metaPrefix) {
+        return
+    }
+
+    kv := strings.SplitN(strings.TrimPrefix(comment, metaPrefix), "=", 2)
+    if len(kv) != 2 {
+        return
+    }
+    if t.meta == nil {
+        t.meta = make(map[string]string)
+    }
+    t.meta[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+}
+
+// Get the metadata read since the last call and forget about it.
+func (t *tokenizer) takeMeta() map[string]string {
+    meta := t.meta
+    t.meta = nil
+    return meta
+}
+
+// Skip everything up to and including the end of a block comment.
+func (t *tokenizer) skipBlockComment() error {
+    for {
+        c, err := t.r.ReadByte(); if err != nil {
+            return fmt.Errorf("Unterminated comment")
+        }
+        if c == '*' && t.following('/') {
+            return nil
+        }
+    }
+}
+
+// A statement of a bind configuration file: a keyword followed by arguments and an optional block of further
+// statements, terminated by a semicolon.
+type statement struct {
+    keyword string
+    args []*token
+    block []*statement
+    // Whether or not the statement has a block, which may still be empty
+    hasBlock bool
+    // Metadata from dnsync comments preceding the statement
+    meta map[string]string
+}
+
+// Parse all statements until the end of the data, or until the closing brace of the current block if inBlock is
+// set.
+func parseStatements(t *tokenizer, inBlock bool) ([]*statement, error) {
+    res := make([]*statement, 0)
+    for {
+        tok, err := t.token()
+        if err == io.EOF {
+            if inBlock {
+                return nil, fmt.Errorf("Unexpected end of file, missing }")
+            }
+            return res, nil
+        }
+        if err != nil {
+            return nil, err
+        }
+
+        switch {
+        case tok.text == "}" && !tok.quoted:
+            if !inBlock {
+                return nil, fmt.Errorf("Unexpected }")
+            }
+            return res, nil
+
+        case tok.text == ";" && !tok.quoted:
+            // empty statement
+            continue
+        }
+
+        stmt, err := parseStatement(t, tok); if err != nil {
+            return nil, err
+        }
+        res = append(res, stmt)
+    }
+}
+
+// Parse the rest of a statement starting with the token first. The first unquoted word becomes the keyword, all
+// other tokens outside of braces become arguments. Elements of address lists are statements of their own, e.g.
+// "10.0.0.1 port 5353;" has the keyword "10.0.0.1".
+func parseStatement(t *tokenizer, first *token) (*statement, error) {
+    stmt := &statement{meta: t.takeMeta()}
+
+    tok := first
+    for {
+        switch {
+        case tok.quoted:
+            stmt.args = append(stmt.args, tok)
+
+        case tok.text == ";":
+            return stmt, nil
+
+        case tok.text == "{":
+            block, err := parseStatements(t, true); if err != nil {
+                return nil, err
+            }
+            stmt.block = append(stmt.block, block...)
+            stmt.hasBlock = true
+
+        case tok.text == "}":
+            return nil, fmt.Errorf("Unexpected } in statement %s", stmt.keyword)
+
+        case stmt.keyword == "" && len(stmt.args) == 0 && !stmt.hasBlock:
+            stmt.keyword = tok.text
+
+        default:
+            stmt.args = append(stmt.args, tok)
+        }
+
+        var err error
+        tok, err = t.token(); if err != nil {
+            return nil, fmt.Errorf("Unexpected end of file in statement %s", stmt.keyword)
+        }
+    }
+}
+
+// Build a Zone from a parsed zone statement.
+func zoneFromStatement(stmt *statement) (*Zone, error) {
+    if len(stmt.args) == 0 {
+        return nil, fmt.Errorf("Zone statement without name")
+    }
+
+    z := &Zone{Name: strings.TrimSuffix(stmt.args[0].text, ".")}
+    if v, ok := stmt.meta[META_ADDED_AT]; ok {
+        added, err := time.Parse(time.RFC3339, v); if err != nil {
+            return nil, fmt.Errorf("Invalid %s of zone %s: %s", META_ADDED_AT, z.Name, v)
+        }
+        z.AddedAt = added
+    }
+    for _, s := range stmt.block {
+        if z.Options.read(s) {
+            continue
+        }
+
+        switch s.keyword {
+        case "type":
+            if len(s.args) > 0 {
+                z.Type = s.args[0].text
+            }
+
+        case "file":
+            if len(s.args) > 0 {
+                z.File = strings.TrimSpace(s.args[0].text)
+            }
+
+        case "masters", "primaries":
+            for _, m := range s.block {
+                args := make([]string, 0, len(m.args))
+                for _, a := range m.args {
+                    args = append(args, a.text)
+                }
+                address := m.keyword
+                if address == "" && len(args) > 0 {
+                    address, args = args[0], args[1:]
+                }
+                if address == "" {
+                    continue
+                }
+
+                master, err := masterFromArgs(address, args); if err != nil {
+                    return nil, fmt.Errorf("Zone %s: %s", z.Name, err)
+                }
+                z.Masters = append(z.Masters, master)
+            }
+        }
+    }
+    return z, nil
+}
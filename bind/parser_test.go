@@ -0,0 +1,82 @@
+package bind
+
+import (
+    "strings"
+    "testing"
+)
+
+const testNamedConf = `
+// Managed by hand
+include "/etc/bind/zones.rfc1918";
+
+options {
+    directory "/var/cache/bind";
+    allow-transfer { none; };
+};
+
+zone "example.com" IN {
+    type slave;
+    masters { 192.0.2.1; 192.0.2.2 port 5353; };
+    file "/var/lib/bind/db.example.com";
+    allow-transfer { !192.0.2.9; key "xfr"; };
+};
+
+# a primary zone must not be imported
+zone "example.org" { type master; file "/etc/bind/db.example.org"; };
+
+/* secondary is the new
+   name for slave */
+zone "2.0.192.in-addr.arpa." {
+    type secondary;
+    primaries {
+        192.0.2.1;
+    };
+    file "/var/lib/bind/db.192.0.2";
+};
+
+view "internal" {
+    zone "internal.example" { type slave; masters { 10.0.0.1; }; file "db.internal"; };
+};
+`
+
+func TestBindConfigRead(t *testing.T) {
+    bc := NewBindConfig()
+    err := bc.Read(strings.NewReader(testNamedConf)); if err != nil {
+        t.Fatalf("Failed to read config: %s", err)
+    }
+
+    expected := []*Zone{
+        {Name: "example.com", Masters: []Master{{Address: "192.0.2.1"}, {Address: "192.0.2.2", Port: 5353}}, File: "/var/lib/bind/db.example.com", Type: "slave",
+            Options: ZoneOptions{AllowTransfer: []string{"!192.0.2.9", "key \"xfr\""}}},
+        {Name: "example.org", File: "/etc/bind/db.example.org", Type: "master"},
+        {Name: "2.0.192.in-addr.arpa", Masters: MastersFrom("192.0.2.1"), File: "/var/lib/bind/db.192.0.2", Type: "secondary"},
+        {Name: "internal.example", Masters: MastersFrom("10.0.0.1"), File: "db.internal", Type: "slave"},
+    }
+
+    for _, e := range expected {
+        z := bc.GetZone(e.Name)
+        if z == nil {
+            t.Fatalf("Zone %s not read:\n%s", e.Name, bc.String())
+        }
+        if !z.Equals(e) || len(z.Masters) != len(e.Masters) || z.Type != e.Type {
+            t.Fatalf("Zone read wrong.\nExpect: %s (%s)\nActual: %s (%s)", e, e.Type, z, z.Type)
+        }
+    }
+    if len(bc.Zones()) != len(expected) {
+        t.Fatalf("Expected %d zones, got %d", len(expected), len(bc.Zones()))
+    }
+}
+
+func TestBindConfigReadInvalid(t *testing.T) {
+    for _, invalid := range []string{
+        `zone "example.com" { type slave;`,
+        `zone "example.com" { type slave; }; };`,
+        `zone "example.com { type slave; };`,
+        `/* unterminated`,
+    } {
+        bc := NewBindConfig()
+        if bc.Read(strings.NewReader(invalid)) == nil {
+            t.Fatalf("Invalid config was read without error: %s", invalid)
+        }
+    }
+}
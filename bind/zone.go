@@ -8,40 +8,61 @@ package bind
 
 import (
     "fmt"
-
-    "github.com/mandrakey/dnsync/tools"
+    "time"
 )
 
 // Represents a bind domain zone.
 type Zone struct {
-    Name string
-    Masters []string
-    File string
+    Name string `json:"name"`
+    Masters []Master `json:"masters"`
+    File string `json:"file"`
+    // The zone type as read from a configuration file, e.g. "slave". Zones are always saved as slave zones.
+    Type string `json:"type,omitempty"`
+    // When the zone was first added by dnsync, zero if unknown
+    AddedAt time.Time `json:"added_at"`
+    Options ZoneOptions `json:"options"`
 }
 
 // Create a new Zone instance based on zone.
 func CopyZone(zone *Zone) *Zone {
-    return &Zone{Name: zone.Name, Masters: zone.Masters, File: zone.File}
+    masters := append([]Master{}, zone.Masters...)
+    return &Zone{Name: zone.Name, Masters: masters, File: zone.File, Type: zone.Type, AddedAt: zone.AddedAt,
+        Options: zone.Options.Copy()}
 }
 
 // Check whether this Zone instance contains all necessary information to be a valid, working DNS zone.
 func (z *Zone) IsValid() bool {
-    return !(z.Name == "" || len(z.Masters) == 0 || z.File == "")
+    return z.Validate() == nil
 }
 
-// Check whether or not this Zone contains the same information as other.
-func (z *Zone) Equals(other *Zone) bool {
-    if z.Name != other.Name || z.File != other.File {
-        return false
+// Check that this Zone contains all necessary information to be a valid, working DNS zone, and that all of it is
+// safe to write into bind configuration files.
+func (z *Zone) Validate() error {
+    if z.Name == "" || len(z.Masters) == 0 || z.File == "" {
+        return fmt.Errorf("Zone name, masters and file are required")
+    }
+    err := ValidateZoneName(z.Name); if err != nil {
+        return err
     }
-
     for _, m := range z.Masters {
-        if !tools.StringInSlice(m, other.Masters) {
-            return false
+        err := m.Validate(); if err != nil {
+            return err
         }
     }
+    err = ValidateFile(z.File); if err != nil {
+        return err
+    }
+    return z.Options.Validate()
+}
+
+// Check whether or not this Zone contains the same information as other. The order of masters does not matter.
+func (z *Zone) Equals(other *Zone) bool {
+    return z.Name == other.Name && z.File == other.File && z.SameMasters(other) && z.Options.Equals(other.Options)
+}
 
-    return true
+// Check whether or not this Zone has the same set of masters as other, regardless of their order.
+func (z *Zone) SameMasters(other *Zone) bool {
+    return SameMasters(z.Masters, other.Masters)
 }
 
 // Create a string representation of this Zone.
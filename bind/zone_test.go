@@ -15,7 +15,7 @@ func TestZoneIsValid(t *testing.T) {
         t.Fatal("zone with only a name should be invalid")
     }
 
-    z = Zone{Masters: []string{"1.2.3.4"}}
+    z = Zone{Masters: MastersFrom("1.2.3.4")}
     if z.IsValid() == true {
         t.Fatal("zone with only masters should be invalid")
     }
@@ -25,7 +25,7 @@ func TestZoneIsValid(t *testing.T) {
         t.Fatal("zone with only file should be invalid")
     }
 
-    z = Zone{Name: "domain.tld.", Masters: []string{"1.2.3.4"}}
+    z = Zone{Name: "domain.tld.", Masters: MastersFrom("1.2.3.4")}
     if z.IsValid() == true {
         t.Fatal("zone with only name and masters should be invalid")
     }
@@ -35,39 +35,48 @@ func TestZoneIsValid(t *testing.T) {
         t.Fatal("zone with only name and file should be invalid")
     }
 
-    z = Zone{Masters: []string{"1.2.3.4"}, File: "somefile"}
+    z = Zone{Masters: MastersFrom("1.2.3.4"), File: "somefile"}
     if z.IsValid() == true {
         t.Fatal("zone with only masters and file should be invalid")
     }
 
-    z = Zone{Name: "domain.tld", Masters: []string{"1.2.3.4"}, File: "somefile"}
+    z = Zone{Name: "domain.tld", Masters: MastersFrom("1.2.3.4"), File: "somefile"}
     if z.IsValid() == false {
         t.Fatal("zone with all data should be valid")
     }
 }
 
 func TestZoneEquals(t *testing.T) {
-    z := &Zone{Name: "domain.tld", Masters: []string{"1.2.3.4", "5.6.7.8"}, File: "somefile"}
+    z := &Zone{Name: "domain.tld", Masters: MastersFrom("1.2.3.4", "5.6.7.8"), File: "somefile"}
 
     if !z.Equals(z) {
         t.Fatal("the same zone struct does not equal itself")
     }
 
-    if z.Equals(&Zone{Name: "domain2.tld", Masters: []string{"1.2.3.4", "5.6.7.8"}, File: "somefile"}) {
+    if z.Equals(&Zone{Name: "domain2.tld", Masters: MastersFrom("1.2.3.4", "5.6.7.8"), File: "somefile"}) {
         t.Fatal("different zone names but zones are equal")
     }
 
-    if z.Equals(&Zone{Name: "domain.tld", Masters: []string{"1.2.3.4"}, File: "somefile"}) {
+    if z.Equals(&Zone{Name: "domain.tld", Masters: MastersFrom("1.2.3.4"), File: "somefile"}) {
         t.Fatal("different zone masters but zones are equal")
     }
 
-    if z.Equals(&Zone{Name: "domain.tld", Masters: []string{"1.2.3.4", "5.6.7.8"}, File: "someotherfile"}) {
+    if z.Equals(&Zone{Name: "domain.tld", Masters: MastersFrom("1.2.3.4", "5.6.7.8"), File: "someotherfile"}) {
         t.Fatal("different zone files but zones are equal")
     }
+
+    more := &Zone{Name: "domain.tld", Masters: MastersFrom("1.2.3.4", "5.6.7.8", "9.10.11.12"), File: "somefile"}
+    if z.Equals(more) || more.Equals(z) {
+        t.Fatal("additional zone masters but zones are equal")
+    }
+
+    if !z.Equals(&Zone{Name: "domain.tld", Masters: MastersFrom("5.6.7.8", "1.2.3.4"), File: "somefile"}) {
+        t.Fatal("zone masters in different order but zones are not equal")
+    }
 }
 
 func TestZoneString(t *testing.T) {
-    z := &Zone{Name: "domain.tld", Masters: []string{"1.2.3.4", "5.6.7.8"}, File: "somefile"}
+    z := &Zone{Name: "domain.tld", Masters: MastersFrom("1.2.3.4", "5.6.7.8"), File: "somefile"}
 
     if z.String() != "zone{Name: 'domain.tld', Masters: [1.2.3.4 5.6.7.8], File: somefile}" {
         t.Fatalf("Zone string output is wrong")
@@ -9,8 +9,11 @@ package config
 import (
     "os"
     "fmt"
+    "io/ioutil"
     "strings"
     "encoding/json"
+
+    "github.com/mandrakey/dnsync/bind"
 )
 
 // Represents the application configuration.
@@ -19,57 +22,200 @@ type AppConfig struct {
     Remotes []string
     Verbose bool
     Logfile string
+    Logtarget string
+    SyslogAddress string `json:"syslog-address"`
     Loglevel string
+    Logformat string
     Simulation bool
     Port int
     Host string
+    MetricsAddress string `json:"metrics-address"`
+    ApiAddress string `json:"api-address"`
+    ApiToken string `json:"api-token"`
+    ReconcileInterval string `json:"reconcile-interval"`
+    ReconcileFix bool `json:"reconcile-fix"`
+    StateFile string `json:"state-file"`
+    // Number of packets handled concurrently and number of packets waiting for a worker
+    Workers int `json:"workers"`
+    QueueSize int `json:"queue-size"`
+    // Packets per second accepted from a single source and the burst allowed on top, 0 (the default) for no limit
+    RateLimit float64 `json:"rate-limit"`
+    RateBurst int `json:"rate-burst"`
+    // Whether or not NOTIFYs for unknown zones wait for approval instead of being passed to the handlers
+    Pending bool `json:"pending"`
+    // How long NOTIFYs wait for approval, e.g. "72h"
+    PendingTTL string `json:"pending-ttl"`
+    // Maximum number of zones waiting for approval, 0 for no limit
+    PendingMax int `json:"pending-max"`
+    // Window in which repeated NOTIFYs for a zone from the same remote are coalesced, e.g. "2s"
+    Debounce string `json:"debounce"`
+    RemoteGroups []RemoteGroup `json:"remote-groups"`
+    // Masters to use for zones notified by a remote, keyed by the remote's address
+    MasterMap map[string][]bind.Master `json:"master-map"`
+    // HTTP endpoints notified about changes of the handlers' zone sets
+    Webhooks []Webhook `json:"webhooks"`
     Handlers []Handler
+
+    sources map[string]string
+}
+
+// A named group of remotes, e.g. the hidden primaries serving the same zones.
+type RemoteGroup struct {
+    Name string `json:"name"`
+    Remotes []string `json:"remotes"`
+    // Masters used for zones notified by the group's remotes, if a handler uses the fixed master policy
+    Masters []bind.Master `json:"masters"`
+}
+
+// An HTTP endpoint receiving a JSON POST for every change of a zone.
+type Webhook struct {
+    URL string `json:"url"`
+    // Key of the HMAC signature sent with every request; no signature is sent if empty
+    Secret string `json:"secret"`
+    // Actions triggering the webhook, by default added, updated and removed
+    Actions []string `json:"actions"`
+    // Number of retries after a failed delivery, DEFAULT_WEBHOOK_RETRIES if not configured
+    Retries int `json:"retries"`
+    // Delay before the first retry, e.g. "1s", doubled for every further retry
+    Backoff string `json:"backoff"`
+    // Time to wait for the endpoint to answer, e.g. "10s"
+    Timeout string `json:"timeout"`
+}
+
+// Number of retries of webhooks whose configuration does not set retries.
+const DEFAULT_WEBHOOK_RETRIES = 3
+
+// Decode a Webhook from the configuration file, defaulting retries to DEFAULT_WEBHOOK_RETRIES; an explicit 0
+// disables retrying.
+func (w *Webhook) UnmarshalJSON(rawdata []byte) error {
+    // Decode into a type without this method to avoid recursion
+    type plainWebhook Webhook
+    data := plainWebhook{Retries: DEFAULT_WEBHOOK_RETRIES}
+    err := json.Unmarshal(rawdata, &data); if err != nil {
+        return err
+    }
+    *w = Webhook(data)
+    return nil
+}
+
+// Encode a Webhook with its secret masked, so it never shows up in logs, see AppConfig.Describe.
+func (w Webhook) MarshalJSON() ([]byte, error) {
+    type plainWebhook Webhook
+    data := plainWebhook(w)
+    if data.Secret != "" {
+        data.Secret = "********"
+    }
+    return json.Marshal(data)
 }
 
 // Basic DNS server handler struct containing BindHandler fields.
 type Handler struct {
     Name string
 	Type string
+    // How the masters of a notified zone are determined: replace, merge or fixed
+    MasterPolicy string `json:"master-policy"`
+    // Maximum number of masters kept by the merge policy, 0 for no limit
+    MaxMasters int `json:"max-masters"`
+    // Maximum number of zones of the handler and of zones per remote that NOTIFYs may create, 0 for no limit
+    MaxZones int `json:"max-zones"`
+    MaxZonesPerRemote int `json:"max-zones-per-remote"`
+    // Which NOTIFYs the handler processes
+    Filter Filter `json:"filter"`
     BindHandler
+    ExecHandler
+    RelayHandler
+}
+
+// Rules selecting the NOTIFYs a handler processes. Zones matching an exclude rule are never processed; if there are
+// include rules, only zones matching one of them are. Suffixes match the zone itself and all zones below it.
+type Filter struct {
+    Include []string `json:"include"`
+    Exclude []string `json:"exclude"`
+    IncludeRegex []string `json:"include-regex"`
+    ExcludeRegex []string `json:"exclude-regex"`
+    // Names of the remote groups whose NOTIFYs are processed; empty for all remotes
+    RemoteGroups []string `json:"remote-groups"`
 }
 
 // Special fields struct for bind server handlers.
 type BindHandler struct {
 	BindConfigFile string `json:"config-file"`
 	BindZonefilesPath string `json:"zonefiles-path"`
+    // Go template for the paths of zone files, e.g. "{{.Path}}/{{.FirstLetter}}/db.{{.Zone}}"
+    BindZonefileTemplate string `json:"zonefile-template"`
+    // Options of all zones added by the handler
+    BindZoneOptions bind.ZoneOptions `json:"zone-options"`
+    // Options of zones matching a pattern, overriding the handler's zone options
+    BindZoneRules []ZoneRule `json:"zone-rules"`
+}
+
+// Special fields struct for exec handlers.
+type ExecHandler struct {
+    // Program and arguments to run for every NOTIFY
+    ExecCommand []string `json:"command"`
+    // How the NOTIFY is passed to the command: "env" for environment variables, "json" for JSON on stdin
+    ExecInput string `json:"input"`
+    // Time the command may run, e.g. "30s"
+    ExecTimeout string `json:"timeout"`
+    // Maximum number of commands running at the same time
+    ExecConcurrency int `json:"concurrency"`
+}
+
+// Special fields struct for relay handlers.
+type RelayHandler struct {
+    // Name servers the NOTIFY is sent to, as "host" or "host:port"
+    RelayTargets []string `json:"targets"`
+    // TSIG key signing the NOTIFYs, as "name:secret" or "algorithm:name:secret"; may be set from the environment,
+    // see HandlerEnvName
+    RelayTsig string `json:"tsig"`
+    // Time to wait for a target's answer, e.g. "5s"
+    RelayTimeout string `json:"target-timeout"`
+    // Number of retries for targets that did not answer
+    RelayRetries int `json:"retries"`
+    // Delay before the first retry, e.g. "1s", doubled for every further retry
+    RelayBackoff string `json:"backoff"`
+}
+
+// Zone options applied to all zones whose name matches a pattern.
+type ZoneRule struct {
+    // Shell pattern as understood by path.Match, e.g. "*.example.com"
+    Pattern string `json:"pattern"`
+    Options bind.ZoneOptions `json:"options"`
 }
 
 // Unmarshal Handler JSON data read from a configuration file.
 // Mainly used to extract and populate specialised handler fields.
 func (h *Handler) UnmarshalJSON(rawdata []byte) error {
-    data := make(map[string]string)
+    // Decode into a type without this method to avoid recursion
+    type plainHandler Handler
+    data := plainHandler{}
     err := json.Unmarshal(rawdata, &data); if err != nil {
         return err
     }
-
-    h.Name = data["name"]
-    h.Type = data["type"]
+    *h = Handler(data)
 
     // BindHandler stuff
-    v, ok := data["config-file"]; if ok {
-        h.BindConfigFile = strings.TrimSuffix(v, "/")
-    }
-    v, ok = data["zonefiles-path"]; if ok {
-        h.BindZonefilesPath = strings.TrimSuffix(v, "/")
-    }
+    h.BindConfigFile = strings.TrimSuffix(h.BindConfigFile, "/")
+    h.BindZonefilesPath = strings.TrimSuffix(h.BindZonefilesPath, "/")
 
     return nil
 }
 
-// The global instance of the AppConfig struct.
-var instance *AppConfig
-
-// Get the global AppConfig instance. If it does not exist yet, it will be created.
-func AppConfigInstance() *AppConfig {
-    if instance == nil {
-        instance = &AppConfig{Loglevel: "info"}
+// Encode a Handler with its TSIG secret masked, so it never shows up in logs, see AppConfig.Describe.
+func (h Handler) MarshalJSON() ([]byte, error) {
+    type plainHandler Handler
+    data := plainHandler(h)
+    if data.RelayTsig != "" {
+        data.RelayTsig = "********"
     }
-    return instance
+    return json.Marshal(data)
+}
+
+// Create a new AppConfig instance populated with default values and return a pointer to it.
+func NewAppConfig() *AppConfig {
+    return &AppConfig{Loglevel: "info", Logformat: LOGFORMAT_TEXT, Logtarget: LOGTARGET_FILE, Workers: 8,
+        QueueSize: 256, RateBurst: 20, Debounce: "2s", PendingTTL: "72h",
+        PendingMax: 1000}
 }
 
 // Populate the fields of this AppConfig by reading data from a given file. The file must be JSON.
@@ -78,18 +224,47 @@ func (ac *AppConfig) LoadFromFile(file string) error {
         return fmt.Errorf("File %s does not exist", file)
     }
 
-    f, err := os.Open(file); if err != nil {
+    data, err := ioutil.ReadFile(file); if err != nil {
         return fmt.Errorf("Failed to open file: %s", err)
     }
 
-    decoder := json.NewDecoder(f)
-    err = decoder.Decode(ac); if err != nil {
+    err = json.Unmarshal(data, ac); if err != nil {
+        return fmt.Errorf("Failed to decode file: %s", err)
+    }
+
+    // Remember which values were set by the file
+    keys := make(map[string]json.RawMessage)
+    err = json.Unmarshal(data, &keys); if err != nil {
         return fmt.Errorf("Failed to decode file: %s", err)
     }
+    for k := range keys {
+        ac.setSource(k, fmt.Sprintf("%s %s", SOURCE_FILE, file))
+    }
+
+    return nil
+}
 
+// Get the remote group ip belongs to, or nil if it is in none.
+func (ac *AppConfig) RemoteGroupOf(ip string) *RemoteGroup {
+    for i := range ac.RemoteGroups {
+        for _, r := range ac.RemoteGroups[i].Remotes {
+            if r == ip {
+                return &ac.RemoteGroups[i]
+            }
+        }
+    }
     return nil
 }
 
+// Get the masters zones notified by the remote ip should get: those configured in the master map, or the remote
+// itself.
+func (ac *AppConfig) MastersOf(ip string) []bind.Master {
+    if masters, ok := ac.MasterMap[ip]; ok && len(masters) > 0 {
+        return append([]bind.Master{}, masters...)
+    }
+    return bind.MastersFrom(ip)
+}
+
 // Retrieve a JSON formatted string representation of the current AppConfig.
 func (ac *AppConfig) String() string {
     res, err := json.Marshal(ac); if err != nil {
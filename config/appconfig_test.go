@@ -2,6 +2,9 @@ package config
 
 import (
     "testing"
+    "encoding/json"
+
+    "github.com/mandrakey/dnsync/bind"
 )
 
 func TestLoadFromFile(t *testing.T) {
@@ -41,4 +44,39 @@ func TestLoadFromFile(t *testing.T) {
     if ac.Handlers[0].BindZonefilesPath != "path1" {
         t.Fatalf("First handler bind zonefiles-path is not path1")
     }
+    if ac.Handlers[0].MasterPolicy != "merge" || ac.Handlers[0].MaxMasters != 2 {
+        t.Fatalf("First handler master policy is not merge with 2 masters")
+    }
+
+    if ac.Handlers[0].BindZoneOptions.Notify != "no" || len(ac.Handlers[0].BindZoneRules) != 1 ||
+            ac.Handlers[0].BindZoneRules[0].Options.AllowTransfer[0] != "key \"xfr\"" {
+        t.Fatalf("First handler zone options not loaded")
+    }
+
+    group := ac.RemoteGroupOf("1.2.3.4")
+    if group == nil || group.Name != "primaries" || len(group.Masters) != 2 {
+        t.Fatalf("Remote 1.2.3.4 is not in group primaries")
+    }
+    if ac.RemoteGroupOf("127.0.0.1") != nil {
+        t.Fatalf("Remote 127.0.0.1 is in a group")
+    }
+
+    masters := ac.MastersOf("127.0.0.1")
+    if len(masters) != 2 || masters[0] != (bind.Master{Address: "10.0.0.3", Port: 5353, Key: "xfr"}) {
+        t.Fatalf("Masters of 127.0.0.1 not mapped: %v", masters)
+    }
+    masters = ac.MastersOf("1.2.3.4")
+    if len(masters) != 1 || masters[0] != (bind.Master{Address: "1.2.3.4"}) {
+        t.Fatalf("Masters of unmapped 1.2.3.4 are not the remote itself: %v", masters)
+    }
+}
+
+func TestWebhookRetries(t *testing.T) {
+    var hooks []Webhook
+    err := json.Unmarshal([]byte(`[{"url": "http://a"}, {"url": "http://b", "retries": 0}]`), &hooks); if err != nil {
+        t.Fatalf("Failed to decode webhooks: %s", err)
+    }
+    if hooks[0].Retries != DEFAULT_WEBHOOK_RETRIES || hooks[1].Retries != 0 {
+        t.Fatalf("Retries not defaulted correctly: %d, %d", hooks[0].Retries, hooks[1].Retries)
+    }
 }
@@ -0,0 +1,263 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package config
+
+import (
+    "os"
+    "fmt"
+    "sort"
+    "strings"
+    "strconv"
+    "encoding/json"
+)
+
+// Prefix of all environment variables which override configuration values.
+const EnvPrefix = "DNSYNC_"
+
+// Possible origins of a configuration value as reported by AppConfig.Source.
+const (
+    SOURCE_DEFAULT = "default"
+    SOURCE_FILE = "file"
+    SOURCE_ENV = "env"
+)
+
+// Describes a configuration value that may be overridden by an environment variable.
+type envOverride struct {
+    key string
+    apply func(ac *AppConfig, value string) error
+}
+
+// All configuration values that can be overridden from the environment. The variable name is built from EnvPrefix
+// and the upper-cased key with dashes replaced by underscores, e.g. "port" becomes DNSYNC_PORT.
+var envOverrides = []envOverride{
+    {"remotes", func(ac *AppConfig, v string) error {
+        ac.Remotes = splitList(v)
+        return nil
+    }},
+    {"port", func(ac *AppConfig, v string) error {
+        port, err := strconv.Atoi(v); if err != nil {
+            return err
+        }
+        ac.Port = port
+        return nil
+    }},
+    {"host", func(ac *AppConfig, v string) error {
+        ac.Host = v
+        return nil
+    }},
+    {"metrics-address", func(ac *AppConfig, v string) error {
+        ac.MetricsAddress = v
+        return nil
+    }},
+    {"api-address", func(ac *AppConfig, v string) error {
+        ac.ApiAddress = v
+        return nil
+    }},
+    {"api-token", func(ac *AppConfig, v string) error {
+        ac.ApiToken = v
+        return nil
+    }},
+    {"reconcile-interval", func(ac *AppConfig, v string) error {
+        ac.ReconcileInterval = v
+        return nil
+    }},
+    {"reconcile-fix", func(ac *AppConfig, v string) error {
+        fix, err := strconv.ParseBool(v); if err != nil {
+            return err
+        }
+        ac.ReconcileFix = fix
+        return nil
+    }},
+    {"state-file", func(ac *AppConfig, v string) error {
+        ac.StateFile = v
+        return nil
+    }},
+    {"workers", func(ac *AppConfig, v string) error {
+        workers, err := strconv.Atoi(v); if err != nil {
+            return err
+        }
+        ac.Workers = workers
+        return nil
+    }},
+    {"queue-size", func(ac *AppConfig, v string) error {
+        size, err := strconv.Atoi(v); if err != nil {
+            return err
+        }
+        ac.QueueSize = size
+        return nil
+    }},
+    {"rate-limit", func(ac *AppConfig, v string) error {
+        rate, err := strconv.ParseFloat(v, 64); if err != nil {
+            return err
+        }
+        ac.RateLimit = rate
+        return nil
+    }},
+    {"rate-burst", func(ac *AppConfig, v string) error {
+        burst, err := strconv.Atoi(v); if err != nil {
+            return err
+        }
+        ac.RateBurst = burst
+        return nil
+    }},
+    {"pending", func(ac *AppConfig, v string) error {
+        pending, err := strconv.ParseBool(v); if err != nil {
+            return err
+        }
+        ac.Pending = pending
+        return nil
+    }},
+    {"pending-ttl", func(ac *AppConfig, v string) error {
+        ac.PendingTTL = v
+        return nil
+    }},
+    {"pending-max", func(ac *AppConfig, v string) error {
+        max, err := strconv.Atoi(v); if err != nil {
+            return err
+        }
+        ac.PendingMax = max
+        return nil
+    }},
+    {"debounce", func(ac *AppConfig, v string) error {
+        ac.Debounce = v
+        return nil
+    }},
+    {"verbose", func(ac *AppConfig, v string) error {
+        verbose, err := strconv.ParseBool(v); if err != nil {
+            return err
+        }
+        ac.Verbose = verbose
+        return nil
+    }},
+    {"logfile", func(ac *AppConfig, v string) error {
+        ac.Logfile = v
+        return nil
+    }},
+    {"logtarget", func(ac *AppConfig, v string) error {
+        ac.Logtarget = v
+        return nil
+    }},
+    {"syslog-address", func(ac *AppConfig, v string) error {
+        ac.SyslogAddress = v
+        return nil
+    }},
+    {"loglevel", func(ac *AppConfig, v string) error {
+        ac.Loglevel = v
+        return nil
+    }},
+    {"logformat", func(ac *AppConfig, v string) error {
+        ac.Logformat = v
+        return nil
+    }},
+}
+
+// Configuration keys whose values must never show up in logs.
+var secretKeys = map[string]bool{
+    "api-token": true,
+}
+
+// Get the name of the environment variable overriding the configuration value key.
+func EnvName(key string) string {
+    return EnvPrefix + strings.ToUpper(strings.Replace(key, "-", "_", -1))
+}
+
+// Get the name of the environment variable overriding the value key of the handler called name, e.g.
+// DNSYNC_HANDLER_FLEET_TSIG. Characters of the name other than letters and digits are replaced by underscores.
+func HandlerEnvName(name, key string) string {
+    safe := strings.Map(func(r rune) rune {
+        if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+            return r
+        }
+        return '_'
+    }, name)
+    return EnvName("handler-" + safe + "-" + key)
+}
+
+// Override configuration values with those set in the environment. Environment variables take precedence over
+// values read from the configuration file, which in turn take precedence over built-in defaults. Secrets of
+// handlers are set by variables named after the handler, see HandlerEnvName.
+func (ac *AppConfig) LoadFromEnv() error {
+    for _, o := range envOverrides {
+        name := EnvName(o.key)
+        v, ok := os.LookupEnv(name); if !ok {
+            continue
+        }
+
+        err := o.apply(ac, v); if err != nil {
+            return fmt.Errorf("Invalid value for %s: %s", name, err)
+        }
+        ac.setSource(o.key, fmt.Sprintf("%s %s", SOURCE_ENV, name))
+    }
+
+    for i := range ac.Handlers {
+        name := HandlerEnvName(ac.Handlers[i].Name, "tsig")
+        v, ok := os.LookupEnv(name); if !ok {
+            continue
+        }
+        ac.Handlers[i].RelayTsig = v
+        ac.setSource("handlers", fmt.Sprintf("%s, %s %s", ac.Source("handlers"), SOURCE_ENV, name))
+    }
+    return nil
+}
+
+// Get a description of where the configuration value key came from: the built-in defaults, the configuration
+// file or an environment variable.
+func (ac *AppConfig) Source(key string) string {
+    s, ok := ac.sources[strings.ToLower(key)]; if !ok {
+        return SOURCE_DEFAULT
+    }
+    return s
+}
+
+// Retrieve a human readable dump of all top-level configuration values along with their origin, one value per
+// line. Secret values are masked.
+func (ac *AppConfig) Describe() string {
+    data, err := json.Marshal(ac); if err != nil {
+        return fmt.Sprintf("Failed to marshal AppConfig to JSON: %s", err)
+    }
+
+    values := make(map[string]json.RawMessage)
+    err = json.Unmarshal(data, &values); if err != nil {
+        return fmt.Sprintf("Failed to unmarshal AppConfig from JSON: %s", err)
+    }
+
+    keys := make([]string, 0, len(values))
+    for k := range values {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+
+    res := make([]string, 0, len(keys))
+    for _, k := range keys {
+        v := string(values[k])
+        if secretKeys[strings.ToLower(k)] && v != "\"\"" {
+            v = "\"********\""
+        }
+        res = append(res, fmt.Sprintf("%s = %s (%s)", strings.ToLower(k), v, ac.Source(k)))
+    }
+    return strings.Join(res, "\n")
+}
+
+// Remember the origin of the configuration value key.
+func (ac *AppConfig) setSource(key, source string) {
+    if ac.sources == nil {
+        ac.sources = make(map[string]string)
+    }
+    ac.sources[strings.ToLower(key)] = source
+}
+
+// Split a comma separated list of values, dropping empty entries.
+func splitList(s string) []string {
+    res := make([]string, 0)
+    for _, item := range strings.Split(s, ",") {
+        item = strings.TrimSpace(item)
+        if item != "" {
+            res = append(res, item)
+        }
+    }
+    return res
+}
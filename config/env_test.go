@@ -0,0 +1,96 @@
+package config
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestLoadFromEnv(t *testing.T) {
+    t.Setenv("DNSYNC_PORT", "5353")
+    t.Setenv("DNSYNC_REMOTES", "10.0.0.1, 10.0.0.2,")
+    t.Setenv("DNSYNC_LOGLEVEL", "debug")
+    t.Setenv("DNSYNC_RATE_LIMIT", "0.5")
+
+    ac := AppConfig{}
+    err := ac.LoadFromFile("./appconfig_test.json"); if err != nil {
+        t.Fatalf("Failed loading config: %s", err)
+    }
+    err = ac.LoadFromEnv(); if err != nil {
+        t.Fatalf("Failed loading environment: %s", err)
+    }
+
+    if ac.Port != 5353 {
+        t.Fatalf("Port is not 5353")
+    }
+    if len(ac.Remotes) != 2 || ac.Remotes[0] != "10.0.0.1" || ac.Remotes[1] != "10.0.0.2" {
+        t.Fatalf("Remotes not overridden from environment: %v", ac.Remotes)
+    }
+    if ac.Host != "0.0.0.0" {
+        t.Fatalf("Host from file was overridden")
+    }
+    if ac.Loglevel != "debug" {
+        t.Fatalf("Loglevel is not debug")
+    }
+    if ac.RateLimit != 0.5 {
+        t.Fatalf("Rate limit not overridden from environment: %v", ac.RateLimit)
+    }
+}
+
+func TestLoadHandlerSecretFromEnv(t *testing.T) {
+    t.Setenv("DNSYNC_HANDLER_FLEET_1_TSIG", "relay:c2VjcmV0")
+
+    ac := AppConfig{Handlers: []Handler{{Name: "fleet-1"}, {Name: "other"}}}
+    err := ac.LoadFromEnv(); if err != nil {
+        t.Fatalf("Failed loading environment: %s", err)
+    }
+    if ac.Handlers[0].RelayTsig != "relay:c2VjcmV0" || ac.Handlers[1].RelayTsig != "" {
+        t.Fatalf("TSIG key not overridden from environment: %+v", ac.Handlers)
+    }
+    if !strings.Contains(ac.Source("handlers"), "env DNSYNC_HANDLER_FLEET_1_TSIG") {
+        t.Fatalf("Source of handlers does not mention the environment: %s", ac.Source("handlers"))
+    }
+}
+
+func TestLoadFromEnvInvalid(t *testing.T) {
+    t.Setenv("DNSYNC_PORT", "not-a-port")
+
+    ac := AppConfig{}
+    if ac.LoadFromEnv() == nil {
+        t.Fatalf("Invalid port in environment should fail")
+    }
+}
+
+func TestSource(t *testing.T) {
+    t.Setenv("DNSYNC_HOST", "127.0.0.1")
+
+    ac := AppConfig{}
+    ac.LoadFromFile("./appconfig_test.json")
+    ac.LoadFromEnv()
+
+    if ac.Source("port") != "file ./appconfig_test.json" {
+        t.Fatalf("Port should come from file, not %s", ac.Source("port"))
+    }
+    if ac.Source("host") != "env DNSYNC_HOST" {
+        t.Fatalf("Host should come from env, not %s", ac.Source("host"))
+    }
+    if ac.Source("logfile") != SOURCE_DEFAULT {
+        t.Fatalf("Logfile should be default, not %s", ac.Source("logfile"))
+    }
+
+    out := ac.Describe()
+    if !strings.Contains(out, "host = \"127.0.0.1\" (env DNSYNC_HOST)") {
+        t.Fatalf("Config dump does not contain host source:\n%s", out)
+    }
+}
+
+func TestDescribeMasksSecrets(t *testing.T) {
+    ac := AppConfig{ApiToken: "token", Webhooks: []Webhook{{URL: "http://localhost", Secret: "s3cret"}}}
+    ac.Handlers = []Handler{{Name: "relay", RelayHandler: RelayHandler{RelayTsig: "relay:c2VjcmV0"}}}
+    out := ac.Describe()
+    if strings.Contains(out, "token\"") || strings.Contains(out, "s3cret") || strings.Contains(out, "c2VjcmV0") {
+        t.Fatalf("Config dump contains secrets:\n%s", out)
+    }
+    if ac.Webhooks[0].Secret != "s3cret" {
+        t.Fatalf("Describe changed the webhook secret")
+    }
+}
@@ -0,0 +1,92 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package config
+
+import (
+    "fmt"
+    "net"
+    "bytes"
+    "strings"
+    "encoding/binary"
+
+    "github.com/op/go-logging"
+)
+
+// Socket of the systemd journal accepting log entries in its native protocol.
+var journaldSocket = "/run/systemd/journal/socket"
+
+// Maps log levels to journal priorities, which are the same as syslog severities.
+var journaldPriorities = map[logging.Level]int{
+    logging.CRITICAL: 2,
+    logging.ERROR: 3,
+    logging.WARNING: 4,
+    logging.NOTICE: 5,
+    logging.INFO: 6,
+    logging.DEBUG: 7,
+}
+
+// Backend sending log records to the systemd journal. Fields of an Event are sent as journal fields of their own.
+type journaldBackend struct {
+    conn *net.UnixConn
+}
+
+// Create a new journaldBackend writing to the journal socket at path.
+func newJournaldBackend(path string) (*journaldBackend, error) {
+    conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"}); if err != nil {
+        return nil, err
+    }
+    return &journaldBackend{conn: conn}, nil
+}
+
+// Send a log record to the journal.
+func (b *journaldBackend) Log(level logging.Level, calldepth int, rec *logging.Record) error {
+    buf := &bytes.Buffer{}
+    writeJournalField(buf, "MESSAGE", rec.Formatted(calldepth + 1))
+    writeJournalField(buf, "PRIORITY", fmt.Sprintf("%d", journaldPriorities[level]))
+    writeJournalField(buf, "SYSLOG_IDENTIFIER", logIdentifier)
+
+    if len(rec.Args) == 1 {
+        if e, ok := rec.Args[0].(*Event); ok {
+            for k, v := range e.Fields {
+                writeJournalField(buf, journalFieldName(k), fmt.Sprintf("%v", v))
+            }
+        }
+    }
+
+    _, err := b.conn.Write(buf.Bytes())
+    return err
+}
+
+// Append a field to a journal entry in buf. Values containing newlines use the binary length-prefixed encoding.
+func writeJournalField(buf *bytes.Buffer, name, value string) {
+    if !strings.Contains(value, "\n") {
+        fmt.Fprintf(buf, "%s=%s\n", name, value)
+        return
+    }
+
+    buf.WriteString(name)
+    buf.WriteByte('\n')
+    binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+    buf.WriteString(value)
+    buf.WriteByte('\n')
+}
+
+// Convert a field name into a valid journal field name, which consists of upper case letters, digits and
+// underscores only and must not start with an underscore.
+func journalFieldName(name string) string {
+    res := strings.Map(func(r rune) rune {
+        switch {
+        case r >= 'a' && r <= 'z':
+            return r - 'a' + 'A'
+        case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+            return r
+        default:
+            return '_'
+        }
+    }, name)
+    return strings.TrimLeft(res, "_")
+}
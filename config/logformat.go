@@ -0,0 +1,102 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package config
+
+import (
+    "io"
+    "fmt"
+    "sort"
+    "strings"
+    "encoding/json"
+
+    "github.com/op/go-logging"
+)
+
+// Supported values for the logformat configuration setting.
+const (
+    LOGFORMAT_TEXT = "text"
+    LOGFORMAT_JSON = "json"
+)
+
+// Structured data attached to a log message, e.g. the zone and remote of a NOTIFY.
+type Fields map[string]interface{}
+
+// A log message carrying structured Fields. Pass it as the only argument to one of the non-formatting Logger
+// methods, e.g. log.Info(NewEvent("message", fields)). Text logs will show the fields as key=value pairs after
+// the message, JSON logs will contain them as separate keys.
+type Event struct {
+    Message string
+    Fields Fields
+}
+
+// Create a new Event with message msg and the given fields.
+func NewEvent(msg string, fields Fields) *Event {
+    return &Event{Message: msg, Fields: fields}
+}
+
+// Create a copy of these Fields, extended with all fields in other. Values in other take precedence.
+func (f Fields) With(other Fields) Fields {
+    res := make(Fields, len(f) + len(other))
+    for k, v := range f {
+        res[k] = v
+    }
+    for k, v := range other {
+        res[k] = v
+    }
+    return res
+}
+
+// Create the text representation of this Event: the message followed by all fields as sorted key=value pairs.
+func (e *Event) String() string {
+    keys := make([]string, 0, len(e.Fields))
+    for k := range e.Fields {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+
+    res := []string{e.Message}
+    for _, k := range keys {
+        res = append(res, fmt.Sprintf("%s=%v", k, e.Fields[k]))
+    }
+    return strings.Join(res, " ")
+}
+
+// Formatter writing log records as JSON objects, one per line.
+type jsonFormatter struct {}
+
+// Format a log record as single line JSON object. Fields of an Event are added as keys of their own.
+func (f jsonFormatter) Format(calldepth int, r *logging.Record, w io.Writer) error {
+    data := make(map[string]interface{})
+
+    if len(r.Args) == 1 {
+        if e, ok := r.Args[0].(*Event); ok {
+            for k, v := range e.Fields {
+                data[k] = v
+            }
+            data["msg"] = e.Message
+        }
+    }
+    if _, ok := data["msg"]; !ok {
+        data["msg"] = r.Message()
+    }
+    data["time"] = r.Time.Format("2006-01-02T15:04:05.000Z07:00")
+    data["level"] = strings.ToLower(r.Level.String())
+
+    out, err := json.Marshal(data); if err != nil {
+        return err
+    }
+    _, err = w.Write(out)
+    return err
+}
+
+// Get the formatter for a given log format. Unknown formats fall back to text.
+func formatterFor(format string) logging.Formatter {
+    if format == LOGFORMAT_JSON {
+        return jsonFormatter{}
+    }
+    return logFormat
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+    "encoding/json"
+
+    "github.com/op/go-logging"
+)
+
+// Create a logger writing to buf in the given format.
+func bufferLogger(buf *bytes.Buffer, format string) *logging.Logger {
+    log := logging.MustGetLogger("test")
+    log.SetBackend(logging.AddModuleLevel(
+        logging.NewBackendFormatter(logging.NewLogBackend(buf, "", 0), formatterFor(format))))
+    return log
+}
+
+func TestEventString(t *testing.T) {
+    e := NewEvent("Handled notify", Fields{"zone": "domain.tld", "action": "added", "duration_ms": 3})
+
+    if e.String() != "Handled notify action=added duration_ms=3 zone=domain.tld" {
+        t.Fatalf("Event string output is wrong: %s", e.String())
+    }
+}
+
+func TestFieldsWith(t *testing.T) {
+    f := Fields{"zone": "domain.tld"}
+    f2 := f.With(Fields{"handler": "bind"})
+
+    if len(f) != 1 {
+        t.Fatalf("Original fields were modified")
+    }
+    if f2["zone"] != "domain.tld" || f2["handler"] != "bind" {
+        t.Fatalf("Combined fields are missing values: %v", f2)
+    }
+}
+
+func TestJSONFormat(t *testing.T) {
+    buf := &bytes.Buffer{}
+    log := bufferLogger(buf, LOGFORMAT_JSON)
+
+    log.Info(NewEvent("Handled notify", Fields{"zone": "domain.tld", "duration_ms": 3}))
+    log.Warningf("plain %s", "message")
+
+    lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+    if len(lines) != 2 {
+        t.Fatalf("Expected 2 log lines, got %d:\n%s", len(lines), buf.String())
+    }
+
+    data := make(map[string]interface{})
+    err := json.Unmarshal([]byte(lines[0]), &data); if err != nil {
+        t.Fatalf("Log line is not JSON: %s", err)
+    }
+    if data["msg"] != "Handled notify" || data["zone"] != "domain.tld" || data["level"] != "info" {
+        t.Fatalf("Event fields missing in JSON output: %s", lines[0])
+    }
+    if data["duration_ms"] != float64(3) {
+        t.Fatalf("Numeric field not kept as number: %s", lines[0])
+    }
+
+    data = make(map[string]interface{})
+    err = json.Unmarshal([]byte(lines[1]), &data); if err != nil {
+        t.Fatalf("Log line is not JSON: %s", err)
+    }
+    if data["msg"] != "plain message" || data["level"] != "warning" {
+        t.Fatalf("Plain message not logged correctly: %s", lines[1])
+    }
+}
+
+func TestTextFormat(t *testing.T) {
+    buf := &bytes.Buffer{}
+    log := bufferLogger(buf, LOGFORMAT_TEXT)
+
+    log.Info(NewEvent("Handled notify", Fields{"zone": "domain.tld"}))
+    if !strings.HasSuffix(strings.TrimSpace(buf.String()), "INFO Handled notify zone=domain.tld") {
+        t.Fatalf("Text output is wrong: %s", buf.String())
+    }
+}
@@ -8,38 +8,105 @@ package config
 
 import (
     "os"
+    "fmt"
+    "strings"
+    "log/syslog"
 
     "github.com/op/go-logging"
 )
 
+// Supported values for the logtarget configuration setting.
+const (
+    LOGTARGET_FILE = "file"
+    LOGTARGET_STDOUT = "stdout"
+    LOGTARGET_SYSLOG = "syslog"
+    LOGTARGET_JOURNALD = "journald"
+)
+
+// Identifier used for messages sent to syslog or journald.
+const logIdentifier = "dnsync"
+
 var (
-    logger = logging.MustGetLogger("dnsync")
     logFormat = logging.MustStringFormatter(`[%{time:2006-01-02 15:04:05}] %{level} %{message}`)
+    // Syslog and journald record time and level on their own
+    logFormatSyslog = logging.MustStringFormatter(`%{message}`)
 )
 
-// Set up the logging subsystem and have it log to the provided logfile.
-func SetupLogging(logfile string) {
-    var backend logging.Backend
-    fp, fperr := os.OpenFile(logfile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-    if fp != nil {
-        backend = logging.NewLogBackend(fp, "", 0)
-    } else {
-        backend = logging.NewLogBackend(os.Stdout, "", 0)
+// Create a new Logger logging to the target configured in ac, using the configured log level and format. If the
+// target cannot be set up, messages go to stdout. Every Logger has its own backend, so several of them can be used
+// side by side.
+func NewLogger(ac *AppConfig) *logging.Logger {
+    backend, err := newLogBackend(ac)
+    if err != nil {
+        backend = logging.NewBackendFormatter(logging.NewLogBackend(os.Stdout, "", 0), formatterFor(ac.Logformat))
     }
 
-    cfg := AppConfigInstance()
-    realBackend := logging.AddModuleLevel(logging.NewBackendFormatter(backend, logFormat))
-    realBackend.SetLevel(stringToLoglevel(cfg.Loglevel), "")
-    logging.SetBackend(realBackend)
+    realBackend := logging.AddModuleLevel(backend)
+    realBackend.SetLevel(stringToLoglevel(ac.Loglevel), "")
+
+    logger := logging.MustGetLogger("dnsync")
+    logger.SetBackend(realBackend)
 
-    if fperr != nil {
-        logger.Warningf("Failed to setup logging to file. Falling back to stdout.\n%s", fperr)
+    if err != nil {
+        logger.Warningf("Failed to setup logging to %s. Falling back to stdout.\n%s", ac.Logtarget, err)
     }
+    return logger
 }
 
-// Get the global Logger instance.
-func Logger() *logging.Logger {
-    return logger
+// Create the formatted backend for the log target configured in ac. For compatibility, the file target without
+// a logfile logs to stdout.
+func newLogBackend(ac *AppConfig) (logging.Backend, error) {
+    switch ac.Logtarget {
+    case LOGTARGET_FILE, "":
+        if ac.Logfile == "" {
+            return logging.NewBackendFormatter(logging.NewLogBackend(os.Stdout, "", 0), formatterFor(ac.Logformat)), nil
+        }
+        fp, err := os.OpenFile(ac.Logfile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); if err != nil {
+            return nil, err
+        }
+        return logging.NewBackendFormatter(logging.NewLogBackend(fp, "", 0), formatterFor(ac.Logformat)), nil
+
+    case LOGTARGET_STDOUT:
+        return logging.NewBackendFormatter(logging.NewLogBackend(os.Stdout, "", 0), formatterFor(ac.Logformat)), nil
+
+    case LOGTARGET_SYSLOG:
+        w, err := dialSyslog(ac.SyslogAddress); if err != nil {
+            return nil, err
+        }
+        return logging.NewBackendFormatter(&logging.SyslogBackend{Writer: w}, syslogFormatterFor(ac.Logformat)), nil
+
+    case LOGTARGET_JOURNALD:
+        b, err := newJournaldBackend(journaldSocket); if err != nil {
+            return nil, err
+        }
+        return logging.NewBackendFormatter(b, syslogFormatterFor(ac.Logformat)), nil
+
+    default:
+        return nil, fmt.Errorf("No such log target: %s", ac.Logtarget)
+    }
+}
+
+// Connect to a syslog server at address, which is given as "udp://host:port" or "tcp://host:port". An empty
+// address connects to the local syslog daemon.
+func dialSyslog(address string) (*syslog.Writer, error) {
+    priority := syslog.LOG_DAEMON|syslog.LOG_INFO
+    if address == "" {
+        return syslog.New(priority, logIdentifier)
+    }
+
+    parts := strings.SplitN(address, "://", 2)
+    if len(parts) != 2 {
+        return nil, fmt.Errorf("Invalid syslog address %s, expected udp://host:port or tcp://host:port", address)
+    }
+    return syslog.Dial(parts[0], parts[1], priority, logIdentifier)
+}
+
+// Get the formatter for syslog-like targets and a given log format.
+func syslogFormatterFor(format string) logging.Formatter {
+    if format == LOGFORMAT_JSON {
+        return jsonFormatter{}
+    }
+    return logFormatSyslog
 }
 
 // Parse a given string s into a useable log level value.
@@ -0,0 +1,93 @@
+package config
+
+import (
+    "net"
+    "time"
+    "strings"
+    "testing"
+    "path/filepath"
+)
+
+// Read a single datagram from conn, failing the test if none arrives in time.
+func readDatagram(t *testing.T, conn net.PacketConn) string {
+    buf := make([]byte, 4096)
+    conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+    n, _, err := conn.ReadFrom(buf); if err != nil {
+        t.Fatalf("No log message received: %s", err)
+    }
+    return string(buf[:n])
+}
+
+func TestSyslogTarget(t *testing.T) {
+    sink, err := net.ListenPacket("udp", "127.0.0.1:0"); if err != nil {
+        t.Fatalf("Failed to open syslog sink: %s", err)
+    }
+    defer sink.Close()
+
+    ac := NewAppConfig()
+    ac.Logtarget = LOGTARGET_SYSLOG
+    ac.SyslogAddress = "udp://" + sink.LocalAddr().String()
+
+    log := NewLogger(ac)
+    log.Warning(NewEvent("Quota reached", Fields{"zone": "domain.tld"}))
+
+    // daemon facility (3) * 8 + warning severity (4)
+    msg := readDatagram(t, sink)
+    if !strings.HasPrefix(msg, "<28>") {
+        t.Fatalf("Syslog message has wrong priority: %s", msg)
+    }
+    if !strings.Contains(msg, "dnsync") || !strings.HasSuffix(strings.TrimSpace(msg), "Quota reached zone=domain.tld") {
+        t.Fatalf("Syslog message has wrong content: %s", msg)
+    }
+
+    log.Error("Something failed")
+    msg = readDatagram(t, sink)
+    if !strings.HasPrefix(msg, "<27>") {
+        t.Fatalf("Syslog error message has wrong priority: %s", msg)
+    }
+}
+
+func TestSyslogTargetInvalidAddress(t *testing.T) {
+    _, err := dialSyslog("localhost:514"); if err == nil {
+        t.Fatalf("Syslog address without protocol should fail")
+    }
+}
+
+func TestJournaldTarget(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "journal.socket")
+    sink, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"}); if err != nil {
+        t.Fatalf("Failed to open journal sink: %s", err)
+    }
+    defer sink.Close()
+
+    old := journaldSocket
+    journaldSocket = path
+    defer func() { journaldSocket = old }()
+
+    ac := NewAppConfig()
+    ac.Logtarget = LOGTARGET_JOURNALD
+    log := NewLogger(ac)
+
+    log.Error(NewEvent("Handler failed", Fields{"request_id": "abc"}))
+    msg := readDatagram(t, sink)
+    for _, expect := range []string{"MESSAGE=Handler failed request_id=abc\n", "PRIORITY=3\n",
+            "SYSLOG_IDENTIFIER=dnsync\n", "REQUEST_ID=abc\n"} {
+        if !strings.Contains(msg, expect) {
+            t.Fatalf("Journal entry does not contain %q:\n%s", expect, msg)
+        }
+    }
+
+    log.Info("multi\nline")
+    msg = readDatagram(t, sink)
+    if !strings.HasPrefix(msg, "MESSAGE\n\x0a\x00\x00\x00\x00\x00\x00\x00multi\nline\n") {
+        t.Fatalf("Multi-line journal entry not length-prefixed: %q", msg)
+    }
+}
+
+func TestUnknownLogTarget(t *testing.T) {
+    ac := NewAppConfig()
+    ac.Logtarget = "carrier-pigeon"
+    _, err := newLogBackend(ac); if err == nil {
+        t.Fatalf("Unknown log target should fail")
+    }
+}
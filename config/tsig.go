@@ -0,0 +1,52 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package config
+
+import (
+    "fmt"
+    "strings"
+    "encoding/base64"
+
+    "github.com/miekg/dns"
+)
+
+// A TSIG key used to sign DNS messages.
+type TsigKey struct {
+    Name string
+    Algorithm string
+    Secret string
+}
+
+// Parse a TSIG key given as "name:secret" or "algorithm:name:secret", with a base64 encoded secret. Without an
+// algorithm, hmac-sha256 is used.
+func ParseTsigKey(s string) (*TsigKey, error) {
+    parts := strings.Split(s, ":")
+    key := &TsigKey{Algorithm: dns.HmacSHA256}
+
+    switch len(parts) {
+    case 2:
+        key.Name, key.Secret = parts[0], parts[1]
+    case 3:
+        key.Algorithm, key.Name, key.Secret = dns.Fqdn(strings.ToLower(parts[0])), parts[1], parts[2]
+    default:
+        return nil, fmt.Errorf("Invalid TSIG key %q, expected name:secret or algorithm:name:secret", s)
+    }
+
+    if key.Name == "" {
+        return nil, fmt.Errorf("Invalid TSIG key %q: empty name", s)
+    }
+    _, err := base64.StdEncoding.DecodeString(key.Secret); if err != nil || key.Secret == "" {
+        return nil, fmt.Errorf("Invalid TSIG key %q: secret must be base64 encoded", s)
+    }
+    key.Name = dns.Fqdn(key.Name)
+    return key, nil
+}
+
+// Get the secrets map for a dns.Client signing with this key.
+func (k *TsigKey) Secrets() map[string]string {
+    return map[string]string{k.Name: k.Secret}
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+    "testing"
+
+    "github.com/miekg/dns"
+)
+
+func TestParseTsigKey(t *testing.T) {
+    key, err := ParseTsigKey("xfr-key:c2VjcmV0"); if err != nil {
+        t.Fatalf("Failed to parse key: %s", err)
+    }
+    if key.Name != "xfr-key." || key.Secret != "c2VjcmV0" || key.Algorithm != dns.HmacSHA256 {
+        t.Fatalf("Key parsed wrong: %+v", key)
+    }
+
+    key, err = ParseTsigKey("hmac-sha512:xfr-key:c2VjcmV0"); if err != nil {
+        t.Fatalf("Failed to parse key with algorithm: %s", err)
+    }
+    if key.Algorithm != dns.HmacSHA512 {
+        t.Fatalf("Algorithm parsed wrong: %s", key.Algorithm)
+    }
+
+    for _, invalid := range []string{"", "xfr-key", ":c2VjcmV0", "xfr-key:not base64!", "a:b:c:d"} {
+        if _, err := ParseTsigKey(invalid); err == nil {
+            t.Fatalf("Invalid key %q was accepted", invalid)
+        }
+    }
+}
@@ -9,16 +9,18 @@ package main
 import (
     "fmt"
     "os"
-    "net"
-    "time"
     "os/signal"
     "syscall"
+    "time"
 
+    "github.com/mandrakey/dnsync/bind"
     "github.com/mandrakey/dnsync/config"
     "github.com/mandrakey/dnsync/handler"
+    "github.com/mandrakey/dnsync/server"
+    "github.com/mandrakey/dnsync/state"
+    "github.com/mandrakey/dnsync/webhook"
 
     "github.com/urfave/cli"
-    "github.com/miekg/dns"
 )
 
 const AppVersion = "1.0.0"
@@ -35,43 +37,55 @@ func main() {
             Name: "config, c",
             Value: "./dnsync.json",
             Usage: "Load configuration from `FILE`",
+            EnvVar: "DNSYNC_CONFIG",
             Destination: &configFile,
         },
     }
     app.Action = actionRun
+    app.Commands = []cli.Command{
+        zonesCommand,
+        pendingCommand,
+        notifyCommand,
+        importCommand,
+        exportCommand,
+        reconcileCommand,
+    }
 
     err := app.Run(os.Args)
     if err != nil {
         fmt.Printf("ERROR %s\n", err)
+        os.Exit(1)
     }
 }
 
 // Run action that reads the config, starts the listening server and sets up signal catching.
 func actionRun(c *cli.Context) error {
     // Load config
-    cfg := config.AppConfigInstance()
-    err := cfg.LoadFromFile(configFile); if err != nil {
+    cfg, err := loadConfig(); if err != nil {
         return err
     }
-    cfg.ConfigFile = configFile
 
     // Setup logging
-    config.SetupLogging(cfg.Logfile)
-    log := config.Logger()
+    log := config.NewLogger(cfg)
     log.Noticef("This is dnsync v.%s", AppVersion)
     fmt.Printf("This is dnsync v.%s\n", AppVersion)
     fmt.Println("Copyright (C) 2018 Maurice Bleuel")
     fmt.Println("Licensed under the MIT license.")
 
     if cfg.Verbose {
-        log.Debugf("Loaded config:\n%s", cfg.String())
+        log.Debugf("Loaded config:\n%s", cfg.Describe())
     }
 
-    // Create UDP socket
-    addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)); if err != nil {
+    handlers, err := handler.NewAll(cfg, log); if err != nil {
         return err
     }
-    conn, err := net.ListenUDP("udp", addr); if err != nil {
+
+    store, err := state.New(cfg.StateFile); if err != nil {
+        return err
+    }
+    defer store.Close()
+
+    hooks, err := webhook.New(cfg.Webhooks, log); if err != nil {
         return err
     }
 
@@ -80,88 +94,51 @@ func actionRun(c *cli.Context) error {
     signal.Notify(sigc, syscall.SIGINT)
     signal.Notify(sigc, syscall.SIGTERM)
 
-    log.Infof("Listening on %s", addr.String())
-    fmt.Printf("Listening on %s\n", addr.String())
-    buf := make([]byte, 4096)
-
-    loop:
-    for {
-        conn.SetReadDeadline(time.Now().Add(time.Second))
-        n, raddr, _ := conn.ReadFromUDP(buf)
-
-        if n > 0 {
-            log.Debugf("Read %d bytes from %s", n, raddr.String())
-            go handlePacket(buf, raddr)
-        }
-
-        // Check if we got a signal in the meantime
-        select {
-        case sig := <-sigc:
-            if sig == syscall.SIGINT || sig == syscall.SIGTERM {
-                log.Infof("Shutting down.")
-                break loop
-            }
-
-        case <-time.After(time.Millisecond * 100):
-            // pass to continue after 100ms if no signal in channel
-        }
-    }
+    stop := make(chan struct{})
+    go func() {
+        <-sigc
+        close(stop)
+    }()
 
-    return nil
+    fmt.Printf("Listening on %s:%d\n", cfg.Host, cfg.Port)
+    return server.New(cfg, handlers, store, hooks, log).ListenAndServe(stop)
 }
 
-// Method to handle incoming DNS packets. Only packets with opcode NOTIFY and type SOA will be handled, everything
-// else will be discarded. If a valid packet is found, it is sent to every registered handler to work with it. After
-// all handlers have finished processing, a DNS reply packet will be sent to the client before the connection is closed.
-func handlePacket(data []byte, raddr *net.UDPAddr) {
-    log := config.Logger()
-
-    if !validRemote(string(raddr.IP)) {
-        log.Infof("Discard packet from invalid remote address %s", raddr.IP)
-        return
+// Load the configuration from the config file given on the command line and the environment.
+func loadConfig() (*config.AppConfig, error) {
+    cfg := config.NewAppConfig()
+    err := cfg.LoadFromFile(configFile); if err != nil {
+        return nil, err
     }
-
-    msg := dns.Msg{}
-    err := msg.Unpack(data); if err != nil {
-        log.Errorf("Failed to unpack packet: %s", err)
-        return
+    err = cfg.LoadFromEnv(); if err != nil {
+        return nil, err
     }
+    cfg.ConfigFile = configFile
+    return cfg, nil
+}
 
-    if msg.MsgHdr.Opcode != dns.OpcodeNotify || msg.Answer[0].Header().Rrtype != dns.TypeSOA {
-        // invalid request, not a notify
-        log.Info("Skip invalid notify")
-        return
+// Create the dispatcher for the configured webhooks, so changes made on the command line are reported like those
+// made by the daemon. The caller must Wait for it before exiting.
+func loadHooks() (*webhook.Dispatcher, error) {
+    cfg, err := loadConfig(); if err != nil {
+        return nil, err
     }
+    return webhook.New(cfg.Webhooks, config.NewLogger(cfg))
+}
 
-    soa := msg.Answer[0].(*dns.SOA)
-    log.Infof("Received notify for %s", soa.Hdr.Name)
-
-    cfg := config.AppConfigInstance()
-    for _, h := range(cfg.Handlers) {
-        if cfg.Verbose {
-            log.Debugf("Processing message for %s", h.Name)
-        }
-        err = handler.HandleMessage(&h, &msg, raddr); if err != nil {
-            log.Error(err)
-        }
+// Report the change action of zone in the handler name, made on the command line, to hooks.
+func sendZoneEvent(hooks *webhook.Dispatcher, name string, zone *bind.Zone, action handler.Action) {
+    if action == handler.ACTION_UNCHANGED {
+        return
     }
-
-    // Send response
-    res := dns.Msg{}
-    res.SetReply(&msg)
-    log.Debugf("Sending reply to %s:%d", raddr.IP, raddr.Port)
-
-    c := dns.Client{}
-    c.Exchange(&res, fmt.Sprintf("%s:%d", raddr.IP, raddr.Port))
+    hooks.Send(webhook.Event{Zone: zone.Name, Masters: zone.Masters, Handler: name, Action: string(action),
+        Timestamp: time.Now().UTC()})
 }
 
-// Checks whether or not a given ip address is in the list of configured remotes.
-func validRemote(ip string) bool {
-    cfg := config.AppConfigInstance()
-    for _, r := range cfg.Remotes {
-        if r == ip {
-            return true
-        }
+// Open the zone state store configured in the configuration file.
+func loadState() (state.Store, error) {
+    cfg, err := loadConfig(); if err != nil {
+        return nil, err
     }
-    return false
+    return state.New(cfg.StateFile)
 }
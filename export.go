@@ -0,0 +1,53 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package main
+
+import (
+    "os"
+    "fmt"
+    "strings"
+
+    "github.com/mandrakey/dnsync/export"
+
+    "github.com/urfave/cli"
+)
+
+// Export the zones of a handler in a structured format, e.g. for audits or to move them to another name server.
+var exportCommand = cli.Command{
+    Name: "export",
+    Usage: "Export the zones of a handler",
+    Flags: []cli.Flag{
+        cli.StringFlag{
+            Name: "format, f",
+            Value: export.FORMAT_JSON,
+            Usage: fmt.Sprintf("Write zones in `FORMAT`, one of %s", strings.Join(export.Formats, ", ")),
+        },
+        handlerFlag,
+    },
+    Action: actionExport,
+}
+
+// Write all zones of the selected handler to stdout. Zones without a known time of addition are exported with
+// the time dnsync first received a NOTIFY for them.
+func actionExport(c *cli.Context) error {
+    store, err := selectZoneStore(c); if err != nil {
+        return err
+    }
+
+    zones, err := store.Zones(); if err != nil {
+        return err
+    }
+    records, err := loadRecords(); if err != nil {
+        return err
+    }
+    for _, zone := range zones {
+        if rec := records[zone.Name]; rec != nil && zone.AddedAt.IsZero() {
+            zone.AddedAt = rec.FirstSeen
+        }
+    }
+    return export.Write(os.Stdout, c.String("format"), zones)
+}
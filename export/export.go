@@ -0,0 +1,222 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package export
+
+import (
+    "io"
+    "fmt"
+    "time"
+    "bufio"
+    "strings"
+    "encoding/csv"
+    "encoding/json"
+
+    "github.com/mandrakey/dnsync/bind"
+)
+
+// Supported export formats.
+const (
+    FORMAT_JSON = "json"
+    FORMAT_CSV = "csv"
+    FORMAT_BIND = "bind"
+    FORMAT_KNOT = "knot"
+    FORMAT_NSD = "nsd"
+)
+
+// All supported export formats.
+var Formats = []string{FORMAT_JSON, FORMAT_CSV, FORMAT_BIND, FORMAT_KNOT, FORMAT_NSD}
+
+// Write zones to w in the given format.
+func Write(w io.Writer, format string, zones []*bind.Zone) error {
+    switch format {
+    case FORMAT_JSON:
+        return writeJSON(w, zones)
+    case FORMAT_CSV:
+        return writeCSV(w, zones)
+    case FORMAT_BIND:
+        return writeBind(w, zones)
+    case FORMAT_KNOT:
+        return writeKnot(w, zones)
+    case FORMAT_NSD:
+        return writeNSD(w, zones)
+    default:
+        return fmt.Errorf("No such export format: %s", format)
+    }
+}
+
+// A zone as written to JSON exports.
+type jsonZone struct {
+    Name string `json:"name"`
+    Masters []bind.Master `json:"masters"`
+    File string `json:"file"`
+    AddedAt string `json:"added_at,omitempty"`
+    Options *bind.ZoneOptions `json:"options,omitempty"`
+}
+
+// Write zones as JSON array of objects.
+func writeJSON(w io.Writer, zones []*bind.Zone) error {
+    res := make([]jsonZone, 0, len(zones))
+    for _, zone := range zones {
+        z := jsonZone{Name: zone.Name, Masters: zone.Masters, File: zone.File, AddedAt: addedAt(zone)}
+        if !zone.Options.IsEmpty() {
+            z.Options = &zone.Options
+        }
+        res = append(res, z)
+    }
+
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "    ")
+    return enc.Encode(res)
+}
+
+// Write zones as CSV with a header line. Masters are given in bind syntax, multiple masters are separated by
+// semicolons.
+func writeCSV(w io.Writer, zones []*bind.Zone) error {
+    cw := csv.NewWriter(w)
+    cw.Write([]string{"name", "masters", "file", "added_at"})
+    for _, zone := range zones {
+        cw.Write([]string{zone.Name, bind.JoinMasters(zone.Masters, ";"), zone.File, addedAt(zone)})
+    }
+    cw.Flush()
+    return cw.Error()
+}
+
+// Write zones as bind configuration, just like the bind handler does.
+func writeBind(w io.Writer, zones []*bind.Zone) error {
+    bc := bind.NewBindConfig()
+    for _, zone := range zones {
+        bc.AddZone(zone)
+    }
+    return bc.Write(w)
+}
+
+// Write zones as Knot DNS configuration. Every master gets a remote for zone transfers and every master address an
+// ACL allowing its NOTIFYs. TSIG keys must be defined separately.
+func writeKnot(w io.Writer, zones []*bind.Zone) error {
+    bw := bufio.NewWriter(w)
+    masters := uniqueMasters(zones)
+
+    if len(masters) > 0 {
+        fmt.Fprintln(bw, "remote:")
+        for _, m := range masters {
+            fmt.Fprintf(bw, "  - id: %s\n    address: %s\n", knotRemoteID(m), addressWithPort(m))
+            if m.Key != "" {
+                fmt.Fprintf(bw, "    key: %s\n", m.Key)
+            }
+        }
+        fmt.Fprintln(bw, "\nacl:")
+        for _, a := range uniqueAddresses(masters) {
+            fmt.Fprintf(bw, "  - id: %s\n    address: %s\n    action: notify\n", knotID("notify", a), a)
+        }
+        fmt.Fprintln(bw)
+    }
+
+    fmt.Fprintln(bw, "zone:")
+    for _, zone := range zones {
+        remotes := make([]string, 0, len(zone.Masters))
+        for _, m := range zone.Masters {
+            remotes = append(remotes, knotRemoteID(m))
+        }
+        acls := make([]string, 0, len(zone.Masters))
+        for _, a := range uniqueAddresses(zone.Masters) {
+            acls = append(acls, knotID("notify", a))
+        }
+
+        if added := addedAt(zone); added != "" {
+            fmt.Fprintf(bw, "  # added-at %s\n", added)
+        }
+        fmt.Fprintf(bw, "  - domain: %s\n", zone.Name)
+        fmt.Fprintf(bw, "    file: \"%s\"\n", zone.File)
+        fmt.Fprintf(bw, "    master: [%s]\n", strings.Join(remotes, ", "))
+        fmt.Fprintf(bw, "    acl: [%s]\n", strings.Join(acls, ", "))
+    }
+    return bw.Flush()
+}
+
+// Write zones as NSD configuration.
+func writeNSD(w io.Writer, zones []*bind.Zone) error {
+    bw := bufio.NewWriter(w)
+    for i, zone := range zones {
+        if i > 0 {
+            fmt.Fprintln(bw)
+        }
+        if added := addedAt(zone); added != "" {
+            fmt.Fprintf(bw, "# added-at %s\n", added)
+        }
+        fmt.Fprintln(bw, "zone:")
+        fmt.Fprintf(bw, "\tname: \"%s\"\n", zone.Name)
+        fmt.Fprintf(bw, "\tzonefile: \"%s\"\n", zone.File)
+        for _, m := range zone.Masters {
+            key := m.Key
+            if key == "" {
+                key = "NOKEY"
+            }
+            fmt.Fprintf(bw, "\tallow-notify: %s %s\n", m.Address, key)
+            fmt.Fprintf(bw, "\trequest-xfr: %s %s\n", addressWithPort(m), key)
+        }
+    }
+    return bw.Flush()
+}
+
+// Get the time zone was added in RFC 3339 format, or an empty string if unknown.
+func addedAt(zone *bind.Zone) string {
+    if zone.AddedAt.IsZero() {
+        return ""
+    }
+    return zone.AddedAt.UTC().Format(time.RFC3339)
+}
+
+// Collect the masters of all zones, in order of appearance.
+func uniqueMasters(zones []*bind.Zone) []bind.Master {
+    res := make([]bind.Master, 0)
+    for _, zone := range zones {
+        for _, m := range zone.Masters {
+            if !bind.HasMaster(res, m) {
+                res = append(res, m)
+            }
+        }
+    }
+    return res
+}
+
+// Collect the addresses of masters, in order of appearance.
+func uniqueAddresses(masters []bind.Master) []string {
+    seen := make(map[string]bool)
+    res := make([]string, 0)
+    for _, m := range masters {
+        if !seen[m.Address] {
+            seen[m.Address] = true
+            res = append(res, m.Address)
+        }
+    }
+    return res
+}
+
+// Get the address of a master in the address@port notation used by Knot and NSD.
+func addressWithPort(m bind.Master) string {
+    if m.Port == 0 {
+        return m.Address
+    }
+    return fmt.Sprintf("%s@%d", m.Address, m.Port)
+}
+
+// Build the Knot remote identifier of a master, which includes port and key if set.
+func knotRemoteID(m bind.Master) string {
+    id := knotID("master", m.Address)
+    if m.Port != 0 {
+        id += fmt.Sprintf("_%d", m.Port)
+    }
+    if m.Key != "" {
+        id += "_" + m.Key
+    }
+    return id
+}
+
+// Build a Knot configuration identifier for an address.
+func knotID(prefix, address string) string {
+    return prefix + "-" + strings.NewReplacer(".", "_", ":", "_").Replace(address)
+}
@@ -0,0 +1,122 @@
+package export
+
+import (
+    "time"
+    "bytes"
+    "strings"
+    "testing"
+    "encoding/json"
+
+    "github.com/mandrakey/dnsync/bind"
+)
+
+// Zones used by all export tests.
+func testZones() []*bind.Zone {
+    return []*bind.Zone{
+        {Name: "domain.tld", Masters: bind.MastersFrom("1.2.3.4", "5.6.7.8"), File: "/var/lib/bind/db.domain.tld",
+            AddedAt: time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)},
+        {Name: "domain2.tld", Masters: bind.MastersFrom("1.2.3.4"), File: "/var/lib/bind/db.domain2.tld"},
+    }
+}
+
+// Export the test zones in format and return the output.
+func export(t *testing.T, format string) string {
+    buf := &bytes.Buffer{}
+    err := Write(buf, format, testZones()); if err != nil {
+        t.Fatalf("Failed to export %s: %s", format, err)
+    }
+    return buf.String()
+}
+
+func TestExportJSON(t *testing.T) {
+    zones := make([]map[string]interface{}, 0)
+    err := json.Unmarshal([]byte(export(t, FORMAT_JSON)), &zones); if err != nil {
+        t.Fatalf("Export is not valid JSON: %s", err)
+    }
+
+    if len(zones) != 2 || zones[0]["name"] != "domain.tld" || zones[0]["added_at"] != "2018-05-01T12:00:00Z" {
+        t.Fatalf("JSON export is wrong: %v", zones)
+    }
+    if _, ok := zones[1]["added_at"]; ok {
+        t.Fatalf("Unknown added_at should be omitted: %v", zones[1])
+    }
+}
+
+func TestExportCSV(t *testing.T) {
+    expected := "name,masters,file,added_at\n" +
+        "domain.tld,1.2.3.4;5.6.7.8,/var/lib/bind/db.domain.tld,2018-05-01T12:00:00Z\n" +
+        "domain2.tld,1.2.3.4,/var/lib/bind/db.domain2.tld,\n"
+
+    if out := export(t, FORMAT_CSV); out != expected {
+        t.Fatalf("CSV export is wrong.\nExpect: %s\nActual: %s", expected, out)
+    }
+}
+
+func TestExportBind(t *testing.T) {
+    bc := bind.NewBindConfig()
+    err := bc.Read(strings.NewReader(export(t, FORMAT_BIND))); if err != nil {
+        t.Fatalf("Bind export cannot be read: %s", err)
+    }
+
+    for _, zone := range testZones() {
+        z := bc.GetZone(zone.Name)
+        if z == nil || !z.Equals(zone) || !z.AddedAt.Equal(zone.AddedAt) {
+            t.Fatalf("Zone %s not exported correctly", zone.Name)
+        }
+    }
+}
+
+func TestExportKnot(t *testing.T) {
+    out := export(t, FORMAT_KNOT)
+
+    for _, expect := range []string{
+        "remote:\n  - id: master-1_2_3_4\n    address: 1.2.3.4\n",
+        "  - id: notify-5_6_7_8\n    address: 5.6.7.8\n    action: notify\n",
+        "  # added-at 2018-05-01T12:00:00Z\n  - domain: domain.tld\n",
+        "    master: [master-1_2_3_4, master-5_6_7_8]\n",
+    } {
+        if !strings.Contains(out, expect) {
+            t.Fatalf("Knot export does not contain %q:\n%s", expect, out)
+        }
+    }
+    if strings.Count(out, "  - id: master-1_2_3_4\n") != 1 {
+        t.Fatalf("Shared master exported more than once:\n%s", out)
+    }
+}
+
+func TestExportNSD(t *testing.T) {
+    out := export(t, FORMAT_NSD)
+
+    for _, expect := range []string{
+        "# added-at 2018-05-01T12:00:00Z\nzone:\n\tname: \"domain.tld\"\n\tzonefile: \"/var/lib/bind/db.domain.tld\"\n",
+        "\tallow-notify: 5.6.7.8 NOKEY\n\trequest-xfr: 5.6.7.8 NOKEY\n",
+    } {
+        if !strings.Contains(out, expect) {
+            t.Fatalf("NSD export does not contain %q:\n%s", expect, out)
+        }
+    }
+}
+
+func TestExportMasterClauses(t *testing.T) {
+    zones := []*bind.Zone{
+        {Name: "domain.tld", Masters: []bind.Master{{Address: "10.0.0.1", Port: 5353, Key: "xfr"}}, File: "db.domain.tld"},
+    }
+
+    buf := &bytes.Buffer{}
+    Write(buf, FORMAT_KNOT, zones)
+    if !strings.Contains(buf.String(), "  - id: master-10_0_0_1_5353_xfr\n    address: 10.0.0.1@5353\n    key: xfr\n") {
+        t.Fatalf("Knot export lacks port or key:\n%s", buf.String())
+    }
+
+    buf.Reset()
+    Write(buf, FORMAT_NSD, zones)
+    if !strings.Contains(buf.String(), "\tallow-notify: 10.0.0.1 xfr\n\trequest-xfr: 10.0.0.1@5353 xfr\n") {
+        t.Fatalf("NSD export lacks port or key:\n%s", buf.String())
+    }
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+    if Write(&bytes.Buffer{}, "xml", testZones()) == nil {
+        t.Fatal("Unknown format should fail")
+    }
+}
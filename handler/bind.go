@@ -0,0 +1,231 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package handler
+
+import (
+    "os"
+    "fmt"
+    "sync"
+    "time"
+    "path/filepath"
+    "text/template"
+
+    "github.com/op/go-logging"
+
+    "github.com/mandrakey/dnsync/bind"
+    "github.com/mandrakey/dnsync/config"
+)
+
+// Handler for a BIND name server, maintaining a configuration file with slave zones.
+type bindHandler struct {
+    cfg config.Handler
+    log *logging.Logger
+    // Template for the paths of zone files without explicit file
+    zonefile *template.Template
+    filter *filter
+
+    // Serializes access to the bind configuration file within the process, see lock
+    mu sync.Mutex
+}
+
+// Create a new bindHandler for a given handler configuration.
+func newBindHandler(cfg config.Handler, log *logging.Logger) (*bindHandler, error) {
+    tpl, err := parseZonefileTemplate(cfg.BindZonefileTemplate); if err != nil {
+        return nil, fmt.Errorf("Handler %s: %s", cfg.Name, err)
+    }
+    err = validZoneOptions(cfg); if err != nil {
+        return nil, err
+    }
+    f, err := newFilter(cfg.Filter); if err != nil {
+        return nil, fmt.Errorf("Handler %s: %s", cfg.Name, err)
+    }
+    return &bindHandler{cfg: cfg, log: log, zonefile: tpl, filter: f}, nil
+}
+
+// Get the configured name of this handler.
+func (h *bindHandler) Name() string {
+    return h.cfg.Name
+}
+
+// Handles a DNS NOTIFY packet for a bind nameserver: The zone will be constructed and, if necessary, added to
+// the bind dnsync configuration file. Its masters are determined by the handler's master policy. Zones dnsync has
+// seen before are added with the time they were first notified. Zones rejected by the handler's filter are
+// skipped.
+func (h *bindHandler) HandleMessage(req *Request) (Action, error) {
+    if !filterRequest(h.filter, h.log, h.Name(), req) {
+        return ACTION_FILTERED, nil
+    }
+
+    zone := &bind.Zone{Name: req.Zone}
+    if req.State != nil {
+        zone.AddedAt = req.State.FirstSeen.UTC().Truncate(time.Second)
+    }
+    return h.addZone(zone, req, req.Fields().With(config.Fields{"handler": h.Name()}))
+}
+
+// Add a zone to the bind dnsync configuration file, replacing an existing zone of the same name. If the zone has
+// no file set, an existing zone's file is kept, otherwise the path is built from the handler's zone file template.
+// Likewise, a zone without options keeps those of an existing zone or gets the ones configured for it.
+func (h *bindHandler) AddZone(zone *bind.Zone) (Action, error) {
+    return h.addZone(zone, nil, config.Fields{"handler": h.Name(), "zone": zone.Name})
+}
+
+// Remove the zone name from the bind dnsync configuration file.
+func (h *bindHandler) RemoveZone(name string) (Action, error) {
+    fields := config.Fields{"handler": h.Name(), "zone": name}
+
+    unlock, err := h.lock(); if err != nil {
+        return ACTION_ERROR, err
+    }
+    defer unlock()
+
+    bc, err := h.load(); if err != nil {
+        return ACTION_ERROR, err
+    }
+
+    zone := bc.GetZone(name); if zone == nil {
+        return ACTION_UNCHANGED, nil
+    }
+
+    bc.RemoveZone(zone)
+    h.log.Debug(config.NewEvent(fmt.Sprintf("New slave zones: %s", bc.String()), fields))
+
+    err = bc.Save(h.cfg.BindConfigFile); if err != nil {
+        return ACTION_ERROR, err
+    }
+    return ACTION_REMOVED, nil
+}
+
+// Add or update a zone in the bind dnsync configuration file. This is the single path all changes of the zone
+// set go through, regardless of whether they are caused by a NOTIFY or made manually. For NOTIFYs, req is set and
+// the masters of the zone are determined from it and the existing zone; new zones exceeding one of the handler's
+// quotas are refused.
+func (h *bindHandler) addZone(zone *bind.Zone, req *Request, fields config.Fields) (Action, error) {
+    err := bind.ValidateZoneName(zone.Name); if err != nil {
+        return ACTION_ERROR, err
+    }
+
+    unlock, err := h.lock(); if err != nil {
+        return ACTION_ERROR, err
+    }
+    defer unlock()
+
+    bc, err := h.load(); if err != nil {
+        return ACTION_ERROR, err
+    }
+    h.log.Debug(config.NewEvent(fmt.Sprintf("Current slave zones: %s", bc.String()), fields))
+
+    existing := bc.GetZone(zone.Name)
+    if existing == nil && req != nil {
+        reason, err := quotaExceeded(h.cfg, bc.Zones(), req); if err != nil {
+            return ACTION_ERROR, err
+        }
+        if reason != "" {
+            h.log.Warning(config.NewEvent(fmt.Sprintf("Refusing new zone: %s", reason), fields))
+            return ACTION_REFUSED, nil
+        }
+    }
+    if req != nil {
+        var current []bind.Master
+        if existing != nil {
+            current = existing.Masters
+        }
+        zone.Masters = mastersFor(h.cfg, req, current)
+    }
+    if zone.File == "" && existing != nil {
+        zone.File = existing.File
+    }
+    if zone.Options.IsEmpty() {
+        if existing != nil {
+            zone.Options = existing.Options
+        } else {
+            zone.Options = zoneOptionsFor(h.cfg, zone.Name)
+        }
+    }
+    if zone.File == "" {
+        file, err := zonefilePath(h.zonefile, h.cfg.BindZonefilesPath, zone.Name); if err != nil {
+            return ACTION_ERROR, err
+        }
+        err = os.MkdirAll(filepath.Dir(file), 0755); if err != nil {
+            return ACTION_ERROR, fmt.Errorf("Failed to create directory for zone file %s: %s", file, err)
+        }
+        zone.File = file
+    }
+    err = zone.Validate(); if err != nil {
+        return ACTION_ERROR, fmt.Errorf("Invalid zone %s: %s", zone.String(), err)
+    }
+    h.log.Debug(config.NewEvent(fmt.Sprintf("Handling BIND zone: %s", zone.String()), fields))
+
+    action := ACTION_ADDED
+    if existing != nil {
+        if existing.Equals(zone) {
+            return ACTION_UNCHANGED, nil
+        }
+        if !existing.AddedAt.IsZero() {
+            zone.AddedAt = existing.AddedAt
+        }
+        action = ACTION_UPDATED
+    } else if zone.AddedAt.IsZero() {
+        zone.AddedAt = time.Now().UTC().Truncate(time.Second)
+    }
+
+    bc.AddZone(zone)
+    h.log.Debug(config.NewEvent(fmt.Sprintf("New slave zones: %s", bc.String()), fields))
+
+    err = bc.Save(h.cfg.BindConfigFile); if err != nil {
+        return ACTION_ERROR, err
+    }
+    return action, nil
+}
+
+// Determine the masters the handler gives the zone notified by req if it has the masters current so far.
+func (h *bindHandler) mastersAfter(req *Request, current []bind.Master) []bind.Master {
+    return mastersFor(h.cfg, req, current)
+}
+
+// Get the filter deciding which zones the handler processes.
+func (h *bindHandler) zoneFilter() *filter {
+    return h.filter
+}
+
+// Retrieve all zones in the bind dnsync configuration file.
+func (h *bindHandler) Zones() ([]*bind.Zone, error) {
+    unlock, err := h.lock(); if err != nil {
+        return nil, err
+    }
+    defer unlock()
+
+    bc, err := h.load(); if err != nil {
+        return nil, err
+    }
+    return bc.Zones(), nil
+}
+
+// Lock the bind dnsync configuration file for loading and saving it. Besides other goroutines, this excludes other
+// dnsync processes sharing the file, like the zones commands run next to the daemon. The returned function releases
+// the lock.
+func (h *bindHandler) lock() (func(), error) {
+    h.mu.Lock()
+    unlock, err := lockFile(h.cfg.BindConfigFile); if err != nil {
+        h.mu.Unlock()
+        return nil, err
+    }
+    return func() {
+        unlock()
+        h.mu.Unlock()
+    }, nil
+}
+
+// Load the bind dnsync configuration file. A missing file is treated as a configuration without zones, since it
+// will be created with the first zone added.
+func (h *bindHandler) load() (*bind.BindConfig, error) {
+    bc := bind.NewBindConfig()
+    if _, err := os.Stat(h.cfg.BindConfigFile); os.IsNotExist(err) {
+        return bc, nil
+    }
+    return bc, bc.Load(h.cfg.BindConfigFile)
+}
@@ -0,0 +1,195 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package handler
+
+import (
+    "os"
+    "fmt"
+    "time"
+    "bytes"
+    "context"
+    "strings"
+    "os/exec"
+    "encoding/json"
+
+    "github.com/op/go-logging"
+
+    "github.com/mandrakey/dnsync/bind"
+    "github.com/mandrakey/dnsync/config"
+)
+
+// Ways of passing a NOTIFY to the command of an exec handler.
+const (
+    // As DNSYNC_* environment variables
+    EXEC_INPUT_ENV = "env"
+    // As JSON object on standard input
+    EXEC_INPUT_JSON = "json"
+)
+
+// Default time the command of an exec handler may run.
+const DEFAULT_EXEC_TIMEOUT = 30 * time.Second
+
+// Maximum length of command output included in errors.
+const maxExecOutput = 512
+
+// Handler running a command for every NOTIFY. The command succeeds if it exits with status 0.
+type execHandler struct {
+    cfg config.Handler
+    log *logging.Logger
+    filter *filter
+    timeout time.Duration
+    // Holds a token for every running command
+    slots chan struct{}
+}
+
+// The NOTIFY as passed to the command, either as environment variables or as JSON.
+type execInput struct {
+    Zone string `json:"zone"`
+    Masters []bind.Master `json:"masters"`
+    Remote string `json:"remote"`
+    Serial uint32 `json:"serial"`
+    Handler string `json:"handler"`
+    RequestID string `json:"request_id"`
+    // Whether or not dnsync never received a NOTIFY for the zone before
+    New bool `json:"new"`
+}
+
+// Create a new execHandler for a given handler configuration.
+func newExecHandler(cfg config.Handler, log *logging.Logger) (*execHandler, error) {
+    if len(cfg.ExecCommand) == 0 {
+        return nil, fmt.Errorf("Handler %s: a command is required", cfg.Name)
+    }
+    switch cfg.ExecInput {
+    case "", EXEC_INPUT_ENV, EXEC_INPUT_JSON:
+    default:
+        return nil, fmt.Errorf("Handler %s: invalid input %s", cfg.Name, cfg.ExecInput)
+    }
+
+    timeout := DEFAULT_EXEC_TIMEOUT
+    if cfg.ExecTimeout != "" {
+        var err error
+        timeout, err = time.ParseDuration(cfg.ExecTimeout); if err != nil {
+            return nil, fmt.Errorf("Handler %s: invalid timeout: %s", cfg.Name, err)
+        }
+    }
+    concurrency := cfg.ExecConcurrency
+    if concurrency < 1 {
+        concurrency = 1
+    }
+
+    f, err := newFilter(cfg.Filter); if err != nil {
+        return nil, fmt.Errorf("Handler %s: %s", cfg.Name, err)
+    }
+    return &execHandler{cfg: cfg, log: log, filter: f, timeout: timeout, slots: make(chan struct{}, concurrency)}, nil
+}
+
+// Get the configured name of this handler.
+func (h *execHandler) Name() string {
+    return h.cfg.Name
+}
+
+// Determine the masters passed to the command for req. The handler keeps no zones, so current is ignored.
+func (h *execHandler) mastersAfter(req *Request, current []bind.Master) []bind.Master {
+    return mastersFor(h.cfg, req, nil)
+}
+
+// Handles a DNS NOTIFY packet by running the configured command. The masters passed to it are determined by the
+// handler's master policy; since the handler keeps no zones, merging starts from scratch every time. Zones never
+// notified before are reported as added, all others as updated. Zones rejected by the handler's filter are
+// skipped.
+func (h *execHandler) HandleMessage(req *Request) (Action, error) {
+    if !filterRequest(h.filter, h.log, h.Name(), req) {
+        return ACTION_FILTERED, nil
+    }
+
+    in := execInput{Zone: req.Zone, Masters: h.mastersAfter(req, nil), Remote: req.Remote.IP.String(),
+        Serial: req.Serial, Handler: h.Name(), RequestID: req.ID, New: req.State == nil}
+    fields := req.Fields().With(config.Fields{"handler": h.Name()})
+
+    ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+    defer cancel()
+
+    // Wait for a free slot, which counts against the timeout
+    select {
+    case h.slots <- struct{}{}:
+        defer func() { <-h.slots }()
+    case <-ctx.Done():
+        return ACTION_ERROR, fmt.Errorf("No free slot to run %s within %s", h.cfg.ExecCommand[0], h.timeout)
+    }
+
+    err := h.run(ctx, in, fields); if err != nil {
+        return ACTION_ERROR, err
+    }
+    if in.New {
+        return ACTION_ADDED, nil
+    }
+    return ACTION_UPDATED, nil
+}
+
+// Run the command for in and map its exit status to an error.
+func (h *execHandler) run(ctx context.Context, in execInput, fields config.Fields) error {
+    cmd := exec.CommandContext(ctx, h.cfg.ExecCommand[0], h.cfg.ExecCommand[1:]...)
+    out := &bytes.Buffer{}
+    cmd.Stdout = out
+    cmd.Stderr = out
+    // Do not wait for children of the command that keep its output open after it was killed
+    cmd.WaitDelay = time.Second
+
+    cmd.Env = commandEnv()
+    if h.cfg.ExecInput == EXEC_INPUT_JSON {
+        data, err := json.Marshal(in); if err != nil {
+            return err
+        }
+        cmd.Stdin = bytes.NewReader(data)
+    } else {
+        cmd.Env = append(cmd.Env, in.env()...)
+    }
+
+    h.log.Debug(config.NewEvent(fmt.Sprintf("Running %s", strings.Join(h.cfg.ExecCommand, " ")), fields))
+    err := cmd.Run()
+    output := strings.TrimSpace(out.String())
+    if len(output) > maxExecOutput {
+        output = output[:maxExecOutput] + "..."
+    }
+
+    if ctx.Err() == context.DeadlineExceeded {
+        return fmt.Errorf("%s timed out after %s", h.cfg.ExecCommand[0], h.timeout)
+    }
+    if exitErr, ok := err.(*exec.ExitError); ok {
+        return fmt.Errorf("%s exited with status %d: %s", h.cfg.ExecCommand[0], exitErr.ExitCode(), output)
+    }
+    if err != nil {
+        return fmt.Errorf("Failed to run %s: %s", h.cfg.ExecCommand[0], err)
+    }
+    h.log.Debug(config.NewEvent(fmt.Sprintf("%s succeeded: %s", h.cfg.ExecCommand[0], output), fields))
+    return nil
+}
+
+// Get the environment of dnsync without the variables overriding its configuration, which may carry secrets like
+// the API token.
+func commandEnv() []string {
+    env := make([]string, 0)
+    for _, v := range os.Environ() {
+        if !strings.HasPrefix(v, config.EnvPrefix) {
+            env = append(env, v)
+        }
+    }
+    return env
+}
+
+// Get the environment variables describing in.
+func (in execInput) env() []string {
+    return []string{
+        "DNSYNC_ZONE=" + in.Zone,
+        "DNSYNC_MASTERS=" + bind.JoinMasters(in.Masters, ","),
+        "DNSYNC_REMOTE=" + in.Remote,
+        fmt.Sprintf("DNSYNC_SERIAL=%d", in.Serial),
+        "DNSYNC_HANDLER=" + in.Handler,
+        "DNSYNC_REQUEST_ID=" + in.RequestID,
+        fmt.Sprintf("DNSYNC_NEW=%t", in.New),
+    }
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+    "net"
+    "strings"
+    "testing"
+    "io/ioutil"
+    "path/filepath"
+    "encoding/json"
+
+    "github.com/mandrakey/dnsync/config"
+    "github.com/mandrakey/dnsync/state"
+)
+
+// Create an exec handler running script with /bin/sh.
+func testExecHandler(t *testing.T, script string, cfg config.ExecHandler) Handler {
+    cfg.ExecCommand = []string{"/bin/sh", "-c", script}
+    h, err := New(config.Handler{Name: "exec", Type: HANDLER_EXEC, ExecHandler: cfg}, testLogger()); if err != nil {
+        t.Fatalf("Failed to create handler: %s", err)
+    }
+    return h
+}
+
+// Create a request for domain.tld notified by 192.0.2.1.
+func execRequest() *Request {
+    req := NewZoneRequest("domain.tld", 42, &net.UDPAddr{IP: net.ParseIP("192.0.2.1")})
+    return req
+}
+
+func TestExecEnv(t *testing.T) {
+    out := filepath.Join(t.TempDir(), "out")
+    h := testExecHandler(t, `echo "$DNSYNC_ZONE $DNSYNC_MASTERS $DNSYNC_REMOTE $DNSYNC_SERIAL $DNSYNC_NEW" > ` + out,
+        config.ExecHandler{})
+
+    action, err := h.HandleMessage(execRequest()); if err != nil || action != ACTION_ADDED {
+        t.Fatalf("Handling new zone was %s: %v", action, err)
+    }
+    data, _ := ioutil.ReadFile(out)
+    if strings.TrimSpace(string(data)) != "domain.tld 192.0.2.1 192.0.2.1 42 true" {
+        t.Fatalf("Wrong environment: %s", data)
+    }
+
+    req := execRequest()
+    req.State = &state.Record{Zone: "domain.tld"}
+    action, err = h.HandleMessage(req); if err != nil || action != ACTION_UPDATED {
+        t.Fatalf("Handling known zone was %s: %v", action, err)
+    }
+}
+
+func TestExecEnvHidesConfig(t *testing.T) {
+    t.Setenv("DNSYNC_API_TOKEN", "secret")
+    t.Setenv("DNSYNC_HANDLER_FLEET_TSIG", "hmac-sha256:fleet:c2VjcmV0")
+    t.Setenv("EXEC_TEST", "kept")
+
+    for _, input := range []string{EXEC_INPUT_ENV, EXEC_INPUT_JSON} {
+        out := filepath.Join(t.TempDir(), "out")
+        h := testExecHandler(t, `echo "$DNSYNC_API_TOKEN|$DNSYNC_HANDLER_FLEET_TSIG|$EXEC_TEST" > ` + out,
+            config.ExecHandler{ExecInput: input})
+
+        _, err := h.HandleMessage(execRequest()); if err != nil {
+            t.Fatalf("Handling zone with %s input failed: %s", input, err)
+        }
+        data, _ := ioutil.ReadFile(out)
+        if strings.TrimSpace(string(data)) != "||kept" {
+            t.Fatalf("Configuration leaked to command with %s input: %s", input, data)
+        }
+    }
+}
+
+func TestExecJSON(t *testing.T) {
+    out := filepath.Join(t.TempDir(), "out")
+    h := testExecHandler(t, "cat > " + out, config.ExecHandler{ExecInput: EXEC_INPUT_JSON})
+
+    _, err := h.HandleMessage(execRequest()); if err != nil {
+        t.Fatalf("Failed to handle request: %s", err)
+    }
+    data, _ := ioutil.ReadFile(out)
+    in := execInput{}
+    err = json.Unmarshal(data, &in); if err != nil {
+        t.Fatalf("Invalid JSON on stdin: %s", err)
+    }
+    if in.Zone != "domain.tld" || in.Remote != "192.0.2.1" || in.Serial != 42 || in.Handler != "exec" ||
+            !in.New || len(in.Masters) != 1 || in.Masters[0].Address != "192.0.2.1" {
+        t.Fatalf("Wrong JSON on stdin: %s", data)
+    }
+}
+
+func TestExecFailure(t *testing.T) {
+    h := testExecHandler(t, "echo broken >&2; exit 3", config.ExecHandler{})
+    action, err := h.HandleMessage(execRequest())
+    if err == nil || action != ACTION_ERROR || !strings.Contains(err.Error(), "status 3: broken") {
+        t.Fatalf("Failing command was %s: %v", action, err)
+    }
+
+    h = testExecHandler(t, "sleep 5", config.ExecHandler{ExecTimeout: "100ms"})
+    action, err = h.HandleMessage(execRequest())
+    if err == nil || action != ACTION_ERROR || !strings.Contains(err.Error(), "timed out") {
+        t.Fatalf("Command running too long was %s: %v", action, err)
+    }
+}
+
+func TestExecConcurrency(t *testing.T) {
+    h := testExecHandler(t, "sleep 1", config.ExecHandler{ExecTimeout: "500ms", ExecConcurrency: 1})
+
+    // Occupy the only slot, so the next command cannot start within its timeout
+    h.(*execHandler).slots <- struct{}{}
+    _, err := h.HandleMessage(execRequest())
+    if err == nil || !strings.Contains(err.Error(), "No free slot") {
+        t.Fatalf("Command started without a free slot: %v", err)
+    }
+}
+
+func TestExecInvalid(t *testing.T) {
+    for _, cfg := range []config.ExecHandler{
+        {},
+        {ExecCommand: []string{"true"}, ExecInput: "xml"},
+        {ExecCommand: []string{"true"}, ExecTimeout: "30"},
+    } {
+        if _, err := New(config.Handler{Name: "exec", Type: HANDLER_EXEC, ExecHandler: cfg}, testLogger()); err == nil {
+            t.Fatalf("Invalid exec handler %+v accepted", cfg)
+        }
+    }
+}
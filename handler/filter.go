@@ -0,0 +1,113 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package handler
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+
+    "github.com/op/go-logging"
+
+    "github.com/mandrakey/dnsync/config"
+    "github.com/mandrakey/dnsync/tools"
+)
+
+// Decides which NOTIFYs a handler processes, see config.Filter.
+type filter struct {
+    include []string
+    exclude []string
+    includeRegex []*regexp.Regexp
+    excludeRegex []*regexp.Regexp
+    remoteGroups []string
+}
+
+// Create a filter from its configuration. A filter without any rules accepts everything.
+func newFilter(cfg config.Filter) (*filter, error) {
+    f := &filter{include: normalizeSuffixes(cfg.Include), exclude: normalizeSuffixes(cfg.Exclude),
+        remoteGroups: cfg.RemoteGroups}
+
+    var err error
+    f.includeRegex, err = compileAll(cfg.IncludeRegex); if err != nil {
+        return nil, err
+    }
+    f.excludeRegex, err = compileAll(cfg.ExcludeRegex); if err != nil {
+        return nil, err
+    }
+    return f, nil
+}
+
+// Decide whether or not req is accepted and give the reason. Remote groups are checked first, then exclude rules,
+// then include rules. If there are include rules, only zones matching one of them are accepted.
+func (f *filter) accepts(req *Request) (bool, string) {
+    if len(f.remoteGroups) > 0 {
+        if req.Group == nil {
+            return false, "remote is in no remote group"
+        }
+        if !tools.StringInSlice(req.Group.Name, f.remoteGroups) {
+            return false, fmt.Sprintf("remote group %s is not accepted", req.Group.Name)
+        }
+    }
+
+    if rule, ok := f.match(req.Zone, f.exclude, f.excludeRegex); ok {
+        return false, fmt.Sprintf("excluded by %s", rule)
+    }
+    if len(f.include) == 0 && len(f.includeRegex) == 0 {
+        return true, "no include rules"
+    }
+    if rule, ok := f.match(req.Zone, f.include, f.includeRegex); ok {
+        return true, fmt.Sprintf("included by %s", rule)
+    }
+    return false, "matches no include rule"
+}
+
+// Find the first suffix or regular expression matching zone and describe it.
+func (f *filter) match(zone string, suffixes []string, regexes []*regexp.Regexp) (string, bool) {
+    for _, s := range suffixes {
+        if zone == s || strings.HasSuffix(zone, "." + s) {
+            return fmt.Sprintf("suffix %s", s), true
+        }
+    }
+    for _, r := range regexes {
+        if r.MatchString(zone) {
+            return fmt.Sprintf("regex %s", r.String()), true
+        }
+    }
+    return "", false
+}
+
+// Apply the filter f of the handler name to req and log the decision. Returns whether or not req is accepted.
+func filterRequest(f *filter, log *logging.Logger, name string, req *Request) bool {
+    ok, reason := f.accepts(req)
+    log.Debug(config.NewEvent("Filter decision", req.Fields().With(config.Fields{
+        "handler": name,
+        "accepted": ok,
+        "reason": reason,
+    })))
+    return ok
+}
+
+// Bring suffixes into the form zone names are stored in.
+func normalizeSuffixes(suffixes []string) []string {
+    res := make([]string, 0, len(suffixes))
+    for _, s := range suffixes {
+        res = append(res, strings.ToLower(strings.Trim(s, ".")))
+    }
+    return res
+}
+
+// Compile all regular expressions in exprs.
+func compileAll(exprs []string) ([]*regexp.Regexp, error) {
+    res := make([]*regexp.Regexp, 0, len(exprs))
+    for _, e := range exprs {
+        r, err := regexp.Compile(e); if err != nil {
+            return nil, fmt.Errorf("Invalid filter regex %s: %s", e, err)
+        }
+        res = append(res, r)
+    }
+    return res, nil
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+    "testing"
+
+    "github.com/mandrakey/dnsync/config"
+)
+
+func TestFilter(t *testing.T) {
+    customers := &config.RemoteGroup{Name: "customers"}
+    internal := &config.RemoteGroup{Name: "internal"}
+
+    tests := []struct {
+        cfg config.Filter
+        zone string
+        group *config.RemoteGroup
+        expect bool
+        reason string
+    }{
+        {config.Filter{}, "domain.tld", nil, true, "no include rules"},
+        {config.Filter{Include: []string{"customer.tld."}}, "a.customer.tld", nil, true, "included by suffix customer.tld"},
+        {config.Filter{Include: []string{"customer.tld"}}, "customer.tld", nil, true, "included by suffix customer.tld"},
+        {config.Filter{Include: []string{"customer.tld"}}, "acustomer.tld", nil, false, "matches no include rule"},
+        {config.Filter{Exclude: []string{"internal.tld"}}, "a.internal.tld", nil, false, "excluded by suffix internal.tld"},
+        {config.Filter{Include: []string{"tld"}, Exclude: []string{"internal.tld"}}, "a.internal.tld", nil, false,
+            "excluded by suffix internal.tld"},
+        {config.Filter{IncludeRegex: []string{`^c[0-9]+\.`}}, "c42.hosting.tld", nil, true, `included by regex ^c[0-9]+\.`},
+        {config.Filter{ExcludeRegex: []string{`in-addr\.arpa$`}}, "2.0.192.in-addr.arpa", nil, false,
+            `excluded by regex in-addr\.arpa$`},
+        {config.Filter{RemoteGroups: []string{"customers"}}, "domain.tld", customers, true, "no include rules"},
+        {config.Filter{RemoteGroups: []string{"customers"}}, "domain.tld", internal, false,
+            "remote group internal is not accepted"},
+        {config.Filter{RemoteGroups: []string{"customers"}}, "domain.tld", nil, false, "remote is in no remote group"},
+    }
+
+    for _, test := range tests {
+        f, err := newFilter(test.cfg); if err != nil {
+            t.Fatalf("Failed to create filter %+v: %s", test.cfg, err)
+        }
+        ok, reason := f.accepts(&Request{Zone: test.zone, Group: test.group})
+        if ok != test.expect || reason != test.reason {
+            t.Errorf("Filter %+v on %s: got %v (%s), expected %v (%s)", test.cfg, test.zone, ok, reason, test.expect,
+                test.reason)
+        }
+    }
+
+    if _, err := newFilter(config.Filter{IncludeRegex: []string{"("}}); err == nil {
+        t.Fatal("Invalid regex accepted")
+    }
+}
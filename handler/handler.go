@@ -10,52 +10,163 @@ import (
     "fmt"
     "net"
     "strings"
+    "crypto/rand"
+    "encoding/hex"
 
     "github.com/miekg/dns"
+    "github.com/op/go-logging"
 
     "github.com/mandrakey/dnsync/bind"
     "github.com/mandrakey/dnsync/config"
+    "github.com/mandrakey/dnsync/state"
 )
 
 const (
     HANDLER_BIND = "bind"
+    HANDLER_EXEC = "exec"
+    HANDLER_RELAY = "relay"
 )
 
-// Takes a handler configuration, a DNS message packet and a UDP address struct denoting the client. The strategy
-// for handling the packet will be determined using the Handler.Type field. Currently, only BIND is supported.
-func HandleMessage(handler *config.Handler, msg *dns.Msg, raddr *net.UDPAddr) error {
-    log := config.Logger()
+// The outcome of a handler processing a NOTIFY.
+type Action string
 
-    switch handler.Type {
-    case HANDLER_BIND:
-        log.Debug("Handling BIND message")
-        return handleMessageBind(handler, msg, raddr)
+const (
+    ACTION_ADDED Action = "added"
+    ACTION_UPDATED Action = "updated"
+    ACTION_REMOVED Action = "removed"
+    ACTION_UNCHANGED Action = "unchanged"
+    ACTION_FILTERED Action = "filtered"
+    ACTION_REFUSED Action = "refused"
+    ACTION_RELAYED Action = "relayed"
+    ACTION_ERROR Action = "error"
+)
 
-    default:
-        return fmt.Errorf("No such handler type: %s", handler.Type)
+// A single NOTIFY received by dnsync, which is passed to all handlers.
+type Request struct {
+    // Random identifier to correlate all log messages belonging to this request
+    ID string
+    // The notified zone name, without trailing dot
+    Zone string
+    // SOA serial carried by the NOTIFY
+    Serial uint32
+    Msg *dns.Msg
+    Remote *net.UDPAddr
+    // The masters the remote maps to, by default the remote itself
+    Masters []bind.Master
+    // The remote group the remote belongs to, or nil
+    Group *config.RemoteGroup
+    // What dnsync knew about the zone before this NOTIFY, or nil if the zone was never notified before
+    State *state.Record
+    // What dnsync knows about all zones, or nil
+    Store state.Store
+}
+
+// Create a new Request for a NOTIFY message msg received from raddr. msg must contain an SOA record in its
+// answer section.
+func NewRequest(msg *dns.Msg, raddr *net.UDPAddr) *Request {
+    req := NewZoneRequest(strings.TrimSuffix(msg.Answer[0].Header().Name, "."), 0, raddr)
+    req.Msg = msg
+    if soa, ok := msg.Answer[0].(*dns.SOA); ok {
+        req.Serial = soa.Serial
     }
+    return req
 }
 
-// Handles a DNS NOTIFY packet for a bind nameserver: The zone will be constructed and, if necessary, added to
-// the bind dnsync configuration file.
-func handleMessageBind(handler *config.Handler, msg *dns.Msg, raddr *net.UDPAddr) error {
-    log := config.Logger()
+// Create a new Request for a NOTIFY for zone carrying serial that was received from raddr earlier, e.g. one that
+// waited for approval. The Request has no message.
+func NewZoneRequest(zone string, serial uint32, raddr *net.UDPAddr) *Request {
+    id := make([]byte, 8)
+    rand.Read(id)
 
-    domain := strings.TrimSuffix(msg.Answer[0].Header().Name, ".")
-    zone := bind.Zone{
-        Name: domain,
-        Masters: []string{raddr.IP.String()},
-        File: fmt.Sprintf("%s/%s.host", handler.BindZonefilesPath, domain),
+    return &Request{
+        ID: hex.EncodeToString(id),
+        Zone: zone,
+        Serial: serial,
+        Remote: raddr,
+        Masters: bind.MastersFrom(raddr.IP.String()),
     }
-    log.Debugf("Handling BIND message for '%s':\n%s", domain, zone.String())
+}
 
-    bc := bind.NewBindConfig()
-    bc.Load(handler.BindConfigFile)
-    log.Debugf("Current slave zones: %s", bc.String())
+// Get the structured log fields identifying this Request.
+func (r *Request) Fields() config.Fields {
+    return config.Fields{
+        "request_id": r.ID,
+        "zone": r.Zone,
+        "remote": r.Remote.IP.String(),
+        "serial": r.Serial,
+    }
+}
+
+// A Handler processes DNS NOTIFY packets for one configured name server.
+type Handler interface {
+    // Get the configured name of this handler.
+    Name() string
+
+    // Process a NOTIFY request and report what was done with the notified zone.
+    HandleMessage(req *Request) (Action, error)
+}
 
-    bc.AddZone(&zone)
-    log.Debugf("New slave zones: %s", bc.String())
+// A Handler managing a set of zones on its name server, which can also be changed without a NOTIFY.
+type ZoneStore interface {
+    // Retrieve all zones currently managed by the handler, sorted by name.
+    Zones() ([]*bind.Zone, error)
+
+    // Add a zone or update an existing zone of the same name.
+    AddZone(zone *bind.Zone) (Action, error)
+
+    // Remove the zone with the given name.
+    RemoveZone(name string) (Action, error)
+}
 
-    bc.Save(handler.BindConfigFile)
-    return nil
+// A Handler passing NOTIFYs on, which has to see every NOTIFY. It is also run for the NOTIFYs dnsync otherwise
+// answers without involving the handlers: those repeated within the debounce window and those for known zones
+// whose masters did not change.
+type Passthrough interface {
+    Handler
+
+    // Check whether or not the handler is run for every NOTIFY.
+    Passthrough() bool
+}
+
+// Create a new Handler from a handler configuration. The strategy for handling packets will be determined using
+// the Handler.Type field: BIND, a command run for every NOTIFY or relaying the NOTIFY to other name servers.
+func New(cfg config.Handler, log *logging.Logger) (Handler, error) {
+    err := validMasterPolicy(cfg); if err != nil {
+        return nil, err
+    }
+
+    switch cfg.Type {
+    case HANDLER_BIND:
+        h, err := newBindHandler(cfg, log); if err != nil {
+            return nil, err
+        }
+        return h, nil
+
+    case HANDLER_EXEC:
+        h, err := newExecHandler(cfg, log); if err != nil {
+            return nil, err
+        }
+        return h, nil
+
+    case HANDLER_RELAY:
+        h, err := newRelayHandler(cfg, log); if err != nil {
+            return nil, err
+        }
+        return h, nil
+
+    default:
+        return nil, fmt.Errorf("No such handler type: %s", cfg.Type)
+    }
+}
+
+// Create Handler instances for all handler configurations in ac.
+func NewAll(ac *config.AppConfig, log *logging.Logger) ([]Handler, error) {
+    res := make([]Handler, 0, len(ac.Handlers))
+    for _, cfg := range ac.Handlers {
+        h, err := New(cfg, log); if err != nil {
+            return nil, err
+        }
+        res = append(res, h)
+    }
+    return res, nil
 }
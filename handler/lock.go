@@ -0,0 +1,30 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package handler
+
+import (
+    "os"
+    "fmt"
+    "syscall"
+)
+
+// Take an exclusive advisory lock for the file at path, waiting until other processes released theirs. The lock is
+// held on the sidecar file path.lock rather than the file itself, since saving replaces the file. The returned
+// function releases the lock.
+func lockFile(path string) (func(), error) {
+    f, err := os.OpenFile(path + ".lock", os.O_RDWR|os.O_CREATE, 0644); if err != nil {
+        return nil, fmt.Errorf("Failed to open lock file for %s: %s", path, err)
+    }
+    err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX); if err != nil {
+        f.Close()
+        return nil, fmt.Errorf("Failed to lock %s: %s", path, err)
+    }
+    return func() {
+        syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+        f.Close()
+    }, nil
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+    "testing"
+    "time"
+    "path/filepath"
+
+    "github.com/mandrakey/dnsync/bind"
+    "github.com/mandrakey/dnsync/config"
+)
+
+func TestBindHandlerWaitsForFileLock(t *testing.T) {
+    dir := t.TempDir()
+    file := filepath.Join(dir, "dnsync.conf")
+    h, err := New(config.Handler{
+        Name: "bind",
+        Type: HANDLER_BIND,
+        BindHandler: config.BindHandler{BindConfigFile: file, BindZonefilesPath: dir},
+    }, testLogger())
+    if err != nil {
+        t.Fatalf("Failed to create handler: %s", err)
+    }
+
+    // Another process holding the lock
+    unlock, err := lockFile(file); if err != nil {
+        t.Fatalf("Failed to lock file: %s", err)
+    }
+    done := make(chan error)
+    go func() {
+        _, err := h.(ZoneStore).AddZone(&bind.Zone{Name: "domain.tld", Masters: bind.MastersFrom("1.2.3.4")})
+        done <- err
+    }()
+
+    select {
+    case <-done:
+        t.Fatal("Zone added while the file was locked")
+    case <-time.After(100 * time.Millisecond):
+    }
+    unlock()
+    if err := <-done; err != nil {
+        t.Fatalf("Failed to add zone: %s", err)
+    }
+    zones, _ := h.(ZoneStore).Zones()
+    if len(zones) != 1 {
+        t.Fatalf("Zone not added after the lock was released: %v", zones)
+    }
+}
@@ -0,0 +1,85 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package handler
+
+import (
+    "fmt"
+
+    "github.com/mandrakey/dnsync/bind"
+    "github.com/mandrakey/dnsync/config"
+)
+
+// Policies determining the masters of a notified zone.
+const (
+    // The masters of the remote sending the NOTIFY become the only masters
+    MASTER_POLICY_REPLACE = "replace"
+    // The masters of the remote sending the NOTIFY are added to the current masters, dropping the oldest beyond
+    // max-masters
+    MASTER_POLICY_MERGE = "merge"
+    // The masters configured for the remote group of the remote sending the NOTIFY are used
+    MASTER_POLICY_FIXED = "fixed"
+)
+
+// Check whether or not the master policy of a handler configuration is known. An empty policy means replace.
+func validMasterPolicy(cfg config.Handler) error {
+    switch cfg.MasterPolicy {
+    case "", MASTER_POLICY_REPLACE, MASTER_POLICY_MERGE, MASTER_POLICY_FIXED:
+        return nil
+    default:
+        return fmt.Errorf("Invalid master-policy of handler %s: %s", cfg.Name, cfg.MasterPolicy)
+    }
+}
+
+// Determine the masters of the zone notified by req according to the master policy of cfg. current are the
+// masters the handler has for the zone so far, nil if the zone is new. The fixed policy falls back to replacing
+// the masters if the remote is in no group with configured masters.
+func mastersFor(cfg config.Handler, req *Request, current []bind.Master) []bind.Master {
+    switch cfg.MasterPolicy {
+    case MASTER_POLICY_MERGE:
+        res := append([]bind.Master{}, current...)
+        for _, m := range req.Masters {
+            if !bind.HasMaster(res, m) {
+                res = append(res, m)
+            }
+        }
+        if cfg.MaxMasters > 0 && len(res) > cfg.MaxMasters {
+            res = res[len(res) - cfg.MaxMasters:]
+        }
+        return res
+
+    case MASTER_POLICY_FIXED:
+        if req.Group != nil && len(req.Group.Masters) > 0 {
+            return append([]bind.Master{}, req.Group.Masters...)
+        }
+        return append([]bind.Master{}, req.Masters...)
+
+    default:
+        return append([]bind.Master{}, req.Masters...)
+    }
+}
+
+// A Handler deriving the masters of zones from NOTIFYs.
+type masterDeriver interface {
+    mastersAfter(req *Request, current []bind.Master) []bind.Master
+}
+
+// Determine the masters the handlers would give the zone notified by req if it has the masters current so far, nil
+// for a new zone, in handler order and without duplicates. Handlers not deriving masters from NOTIFYs are left out.
+func Masters(handlers []Handler, req *Request, current []bind.Master) []bind.Master {
+    res := make([]bind.Master, 0)
+    for _, h := range handlers {
+        d, ok := h.(masterDeriver); if !ok {
+            continue
+        }
+        for _, m := range d.mastersAfter(req, current) {
+            if !bind.HasMaster(res, m) {
+                res = append(res, m)
+            }
+        }
+    }
+    return res
+}
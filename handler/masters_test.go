@@ -0,0 +1,47 @@
+package handler
+
+import (
+    "net"
+    "testing"
+
+    "github.com/mandrakey/dnsync/bind"
+    "github.com/mandrakey/dnsync/config"
+)
+
+func TestMastersFor(t *testing.T) {
+    group := &config.RemoteGroup{Name: "primaries", Remotes: []string{"1.2.3.4"}, Masters: bind.MastersFrom("10.0.0.1", "10.0.0.2")}
+    mapped := []bind.Master{{Address: "10.0.0.3", Port: 5353, Key: "xfr"}}
+
+    tests := []struct {
+        policy string
+        max int
+        group *config.RemoteGroup
+        masters []bind.Master
+        current []bind.Master
+        expect string
+    }{
+        {"", 0, nil, nil, bind.MastersFrom("5.6.7.8"), "1.2.3.4"},
+        {MASTER_POLICY_REPLACE, 0, group, nil, bind.MastersFrom("5.6.7.8"), "1.2.3.4"},
+        {MASTER_POLICY_REPLACE, 0, nil, mapped, bind.MastersFrom("5.6.7.8"), "10.0.0.3 port 5353 key \"xfr\""},
+        {MASTER_POLICY_MERGE, 0, nil, nil, nil, "1.2.3.4"},
+        {MASTER_POLICY_MERGE, 0, nil, nil, bind.MastersFrom("5.6.7.8"), "5.6.7.8,1.2.3.4"},
+        {MASTER_POLICY_MERGE, 0, nil, nil, bind.MastersFrom("1.2.3.4", "5.6.7.8"), "1.2.3.4,5.6.7.8"},
+        {MASTER_POLICY_MERGE, 2, nil, nil, bind.MastersFrom("5.6.7.8", "9.9.9.9"), "9.9.9.9,1.2.3.4"},
+        {MASTER_POLICY_MERGE, 0, nil, mapped, bind.MastersFrom("5.6.7.8"), "5.6.7.8,10.0.0.3 port 5353 key \"xfr\""},
+        {MASTER_POLICY_FIXED, 0, group, nil, bind.MastersFrom("5.6.7.8"), "10.0.0.1,10.0.0.2"},
+        {MASTER_POLICY_FIXED, 0, nil, nil, bind.MastersFrom("5.6.7.8"), "1.2.3.4"},
+    }
+
+    for _, test := range tests {
+        cfg := config.Handler{MasterPolicy: test.policy, MaxMasters: test.max}
+        req := &Request{Remote: &net.UDPAddr{IP: net.ParseIP("1.2.3.4")}, Group: test.group, Masters: test.masters}
+        if req.Masters == nil {
+            req.Masters = bind.MastersFrom("1.2.3.4")
+        }
+        res := bind.JoinMasters(mastersFor(cfg, req, test.current), ",")
+        if res != test.expect {
+            t.Errorf("Policy %q with max %d and current %v: got %s, expected %s", test.policy, test.max,
+                test.current, res, test.expect)
+        }
+    }
+}
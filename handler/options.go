@@ -0,0 +1,43 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package handler
+
+import (
+    "fmt"
+    "path"
+
+    "github.com/mandrakey/dnsync/bind"
+    "github.com/mandrakey/dnsync/config"
+)
+
+// Check the zone options and rules of a handler configuration.
+func validZoneOptions(cfg config.Handler) error {
+    err := cfg.BindZoneOptions.Validate(); if err != nil {
+        return fmt.Errorf("Invalid zone-options of handler %s: %s", cfg.Name, err)
+    }
+    for _, rule := range cfg.BindZoneRules {
+        if _, err := path.Match(rule.Pattern, ""); err != nil || rule.Pattern == "" {
+            return fmt.Errorf("Invalid zone-rules pattern of handler %s: %q", cfg.Name, rule.Pattern)
+        }
+        err := rule.Options.Validate(); if err != nil {
+            return fmt.Errorf("Invalid zone-rules options for %s of handler %s: %s", rule.Pattern, cfg.Name, err)
+        }
+    }
+    return nil
+}
+
+// Get the options for the zone name: the handler's zone options, overridden by those of all matching zone rules
+// in configuration order.
+func zoneOptionsFor(cfg config.Handler, name string) bind.ZoneOptions {
+    res := cfg.BindZoneOptions.Copy()
+    for _, rule := range cfg.BindZoneRules {
+        if ok, _ := path.Match(rule.Pattern, name); ok {
+            res = res.Merge(rule.Options)
+        }
+    }
+    return res
+}
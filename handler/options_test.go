@@ -0,0 +1,73 @@
+package handler
+
+import (
+    "path/filepath"
+    "testing"
+
+    "github.com/mandrakey/dnsync/bind"
+    "github.com/mandrakey/dnsync/config"
+)
+
+func TestZoneOptionsFor(t *testing.T) {
+    cfg := config.Handler{BindHandler: config.BindHandler{
+        BindZoneOptions: bind.ZoneOptions{Notify: "no", AllowTransfer: []string{"none"}},
+        BindZoneRules: []config.ZoneRule{
+            {Pattern: "*.signed.tld", Options: bind.ZoneOptions{InlineSigning: "yes", DnssecPolicy: "default"}},
+            {Pattern: "*.in-addr.arpa", Options: bind.ZoneOptions{MasterfileFormat: "raw"}},
+            {Pattern: "special.signed.tld", Options: bind.ZoneOptions{AllowTransfer: []string{"key \"xfr\""}}},
+        },
+    }}
+
+    tests := map[string]bind.ZoneOptions{
+        "domain.tld": {Notify: "no", AllowTransfer: []string{"none"}},
+        "a.signed.tld": {Notify: "no", AllowTransfer: []string{"none"}, InlineSigning: "yes", DnssecPolicy: "default"},
+        "special.signed.tld": {Notify: "no", AllowTransfer: []string{"key \"xfr\""}, InlineSigning: "yes",
+            DnssecPolicy: "default"},
+        "2.0.192.in-addr.arpa": {Notify: "no", AllowTransfer: []string{"none"}, MasterfileFormat: "raw"},
+    }
+    for name, expect := range tests {
+        if res := zoneOptionsFor(cfg, name); !res.Equals(expect) {
+            t.Errorf("Options of %s are %+v, expected %+v", name, res, expect)
+        }
+    }
+
+    cfg.BindZoneRules = append(cfg.BindZoneRules, config.ZoneRule{Pattern: "[", Options: bind.ZoneOptions{}})
+    if validZoneOptions(cfg) == nil {
+        t.Fatal("Invalid pattern accepted")
+    }
+}
+
+func TestBindHandlerKeepsOptions(t *testing.T) {
+    dir := t.TempDir()
+    h, err := New(config.Handler{
+        Name: "bind",
+        Type: HANDLER_BIND,
+        BindHandler: config.BindHandler{
+            BindConfigFile: filepath.Join(dir, "dnsync.conf"),
+            BindZonefilesPath: dir,
+            BindZoneOptions: bind.ZoneOptions{Notify: "no", AllowTransfer: []string{"none"}},
+        },
+    }, testLogger())
+    if err != nil {
+        t.Fatalf("Failed to create handler: %s", err)
+    }
+
+    own := bind.ZoneOptions{AllowTransfer: []string{}}
+    _, err = h.(ZoneStore).AddZone(&bind.Zone{Name: "domain.tld", Masters: bind.MastersFrom("1.2.3.4"), Options: own})
+    if err != nil {
+        t.Fatalf("Failed to add zone: %s", err)
+    }
+    action, err := h.HandleMessage(quotaRequest("domain.tld", "192.0.2.1")); if err != nil || action != ACTION_UPDATED {
+        t.Fatalf("NOTIFY not handled: %s, %v", action, err)
+    }
+    zones, _ := h.(ZoneStore).Zones()
+    if len(zones) != 1 || !zones[0].Options.Equals(own) {
+        t.Fatalf("Options of notified zone were replaced: %+v", zones[0].Options)
+    }
+
+    h.HandleMessage(quotaRequest("other.tld", "192.0.2.1"))
+    zones, _ = h.(ZoneStore).Zones()
+    if len(zones) != 2 || zones[1].Options.Notify != "no" {
+        t.Fatalf("New zone did not get the configured options: %+v", zones)
+    }
+}
@@ -0,0 +1,65 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package handler
+
+import (
+    "fmt"
+
+    "github.com/mandrakey/dnsync/bind"
+    "github.com/mandrakey/dnsync/config"
+)
+
+// Check whether or not adding a new zone notified by req to zones, the handler's current zone set, exceeds one of
+// the quotas of cfg. A zone counts against the quota of the remote it originates from according to the state
+// store. Zones the store does not know, e.g. imported ones, count against the quota of a remote if one of their
+// masters is among those the handler would give a zone notified by the remote. Returns a description of the
+// exceeded quota, or an empty string.
+func quotaExceeded(cfg config.Handler, zones []*bind.Zone, req *Request) (string, error) {
+    if cfg.MaxZones > 0 && len(zones) >= cfg.MaxZones {
+        return fmt.Sprintf("handler has reached its maximum of %d zones", cfg.MaxZones), nil
+    }
+    if cfg.MaxZonesPerRemote <= 0 {
+        return "", nil
+    }
+
+    origins := make(map[string]string)
+    if req.Store != nil {
+        records, err := req.Store.List(); if err != nil {
+            return "", fmt.Errorf("Failed to read zone origins: %s", err)
+        }
+        for _, rec := range records {
+            origins[rec.Zone] = rec.Origin
+        }
+    }
+
+    remote := req.Remote.IP.String()
+    masters := mastersFor(cfg, req, nil)
+    count := 0
+    for _, z := range zones {
+        if origin, ok := origins[z.Name]; ok {
+            if origin == remote {
+                count++
+            }
+        } else if sharesMaster(z.Masters, masters) {
+            count++
+        }
+    }
+    if count >= cfg.MaxZonesPerRemote {
+        return fmt.Sprintf("remote %s has reached its maximum of %d zones", remote, cfg.MaxZonesPerRemote), nil
+    }
+    return "", nil
+}
+
+// Check whether or not a and b have a master in common.
+func sharesMaster(a, b []bind.Master) bool {
+    for _, m := range a {
+        if bind.HasMaster(b, m) {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+    "net"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/mandrakey/dnsync/bind"
+    "github.com/mandrakey/dnsync/config"
+    "github.com/mandrakey/dnsync/state"
+)
+
+// Create a request for zone notified by remote.
+func quotaRequest(zone, remote string) *Request {
+    return &Request{Zone: zone, Remote: &net.UDPAddr{IP: net.ParseIP(remote)}, Masters: bind.MastersFrom(remote)}
+}
+
+func TestQuotas(t *testing.T) {
+    dir := t.TempDir()
+    h, err := New(config.Handler{
+        Name: "bind",
+        Type: HANDLER_BIND,
+        MaxZones: 3,
+        MaxZonesPerRemote: 2,
+        BindHandler: config.BindHandler{
+            BindConfigFile: filepath.Join(dir, "dnsync.conf"),
+            BindZonefilesPath: dir,
+        },
+    }, testLogger())
+    if err != nil {
+        t.Fatalf("Failed to create handler: %s", err)
+    }
+
+    tests := []struct {
+        zone string
+        remote string
+        expect Action
+    }{
+        {"a.tld", "192.0.2.1", ACTION_ADDED},
+        {"b.tld", "192.0.2.1", ACTION_ADDED},
+        {"c.tld", "192.0.2.1", ACTION_REFUSED},
+        {"c.tld", "192.0.2.2", ACTION_ADDED},
+        {"d.tld", "192.0.2.3", ACTION_REFUSED},
+        // Existing zones are still updated
+        {"a.tld", "192.0.2.3", ACTION_UPDATED},
+    }
+    for _, test := range tests {
+        action, err := h.HandleMessage(quotaRequest(test.zone, test.remote)); if err != nil {
+            t.Fatalf("Failed to handle %s from %s: %s", test.zone, test.remote, err)
+        }
+        if action != test.expect {
+            t.Fatalf("Notify for %s from %s was %s, expected %s", test.zone, test.remote, action, test.expect)
+        }
+    }
+
+    // Zones added manually are not subject to quotas
+    action, err := h.(ZoneStore).AddZone(&bind.Zone{Name: "e.tld", Masters: bind.MastersFrom("192.0.2.1")})
+    if err != nil || action != ACTION_ADDED {
+        t.Fatalf("Manually added zone was %s: %v", action, err)
+    }
+}
+
+func TestQuotasFixedPolicy(t *testing.T) {
+    dir := t.TempDir()
+    h, err := New(config.Handler{
+        Name: "bind",
+        Type: HANDLER_BIND,
+        MasterPolicy: MASTER_POLICY_FIXED,
+        MaxZonesPerRemote: 1,
+        BindHandler: config.BindHandler{
+            BindConfigFile: filepath.Join(dir, "dnsync.conf"),
+            BindZonefilesPath: dir,
+        },
+    }, testLogger())
+    if err != nil {
+        t.Fatalf("Failed to create handler: %s", err)
+    }
+    group := &config.RemoteGroup{Name: "primaries", Remotes: []string{"192.0.2.1", "192.0.2.2"},
+        Masters: bind.MastersFrom("10.0.0.1")}
+    request := func(zone, remote string, store state.Store) *Request {
+        req := quotaRequest(zone, remote)
+        req.Group, req.Store = group, store
+        return req
+    }
+
+    // Without origins, zones count against every remote of the group giving the same masters
+    action, _ := h.HandleMessage(request("a.tld", "192.0.2.1", nil)); if action != ACTION_ADDED {
+        t.Fatalf("First zone was %s", action)
+    }
+    for _, remote := range []string{"192.0.2.1", "192.0.2.2"} {
+        action, _ = h.HandleMessage(request("b.tld", remote, nil)); if action != ACTION_REFUSED {
+            t.Fatalf("Zone over quota from %s was %s", remote, action)
+        }
+    }
+
+    // With origins, zones count against the remote that notified them first
+    store := state.NewMemoryStore()
+    store.Notify("a.tld", "192.0.2.1", 1, nil, time.Now())
+    action, _ = h.HandleMessage(request("b.tld", "192.0.2.2", store)); if action != ACTION_ADDED {
+        t.Fatalf("Zone of another remote was %s", action)
+    }
+    store.Notify("b.tld", "192.0.2.2", 1, nil, time.Now())
+    action, _ = h.HandleMessage(request("c.tld", "192.0.2.1", store)); if action != ACTION_REFUSED {
+        t.Fatalf("Zone over quota was %s", action)
+    }
+}
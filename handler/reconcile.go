@@ -0,0 +1,160 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package handler
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+
+    "github.com/mandrakey/dnsync/bind"
+    "github.com/mandrakey/dnsync/config"
+)
+
+// Difference of a single zone between the zone sets of several handlers.
+type Drift struct {
+    Zone string
+    // Handler the zone was taken from as reference, the first one having it in configuration order
+    Source string
+    // Handlers lacking the zone
+    Missing []string
+    // Handlers having the zone with masters different from the source
+    MastersDiffer []string
+    // Handlers the zone was re-added to
+    Fixed []string
+    // Masters of the zone in the source handler, which it was re-added with
+    Masters []bind.Master
+}
+
+// Create a string representation of this Drift.
+func (d *Drift) String() string {
+    res := make([]string, 0)
+    if len(d.Missing) > 0 {
+        res = append(res, fmt.Sprintf("missing in %s", strings.Join(d.Missing, ", ")))
+    }
+    if len(d.MastersDiffer) > 0 {
+        res = append(res, fmt.Sprintf("masters differ in %s", strings.Join(d.MastersDiffer, ", ")))
+    }
+    if len(d.Fixed) > 0 {
+        res = append(res, fmt.Sprintf("re-added to %s", strings.Join(d.Fixed, ", ")))
+    }
+    return fmt.Sprintf("%s (source %s): %s", d.Zone, d.Source, strings.Join(res, "; "))
+}
+
+// A Handler restricting the zones it processes with a filter.
+type filtered interface {
+    zoneFilter() *filter
+}
+
+// Compare the zone sets of all handlers managing zones and report every zone that is not present with the same
+// masters in all handlers whose filter accepts it; other handlers are left out of the comparison. If fix is set,
+// zones missing from a handler are re-added to it, using the masters of the source handler and the lagging
+// handler's default zone file location. Differing masters are only reported.
+func Reconcile(cfg *config.AppConfig, handlers []Handler, fix bool) ([]*Drift, error) {
+    names := make([]string, 0)
+    stores := make(map[string]ZoneStore)
+    sets := make(map[string]map[string]*bind.Zone)
+    for _, h := range handlers {
+        store, ok := h.(ZoneStore); if !ok {
+            continue
+        }
+
+        zones, err := store.Zones(); if err != nil {
+            return nil, fmt.Errorf("Failed to read zones of %s: %s", h.Name(), err)
+        }
+        names = append(names, h.Name())
+        stores[h.Name()] = store
+        sets[h.Name()] = make(map[string]*bind.Zone)
+        for _, zone := range zones {
+            sets[h.Name()][zone.Name] = zone
+        }
+    }
+
+    // All zone names, sorted for a stable report
+    all := make([]string, 0)
+    seen := make(map[string]bool)
+    for _, name := range names {
+        for zone := range sets[name] {
+            if !seen[zone] {
+                seen[zone] = true
+                all = append(all, zone)
+            }
+        }
+    }
+    sort.Strings(all)
+
+    res := make([]*Drift, 0)
+    for _, zoneName := range all {
+        req := reconcileRequest(cfg, zoneName, names, sets)
+        d := &Drift{Zone: zoneName}
+        var source *bind.Zone
+        for _, name := range names {
+            if f, ok := stores[name].(filtered); ok {
+                if accepted, _ := f.zoneFilter().accepts(req); !accepted {
+                    continue
+                }
+            }
+
+            zone, ok := sets[name][zoneName]
+            switch {
+            case !ok:
+                d.Missing = append(d.Missing, name)
+            case source == nil:
+                source, d.Source = zone, name
+            case !source.SameMasters(zone):
+                d.MastersDiffer = append(d.MastersDiffer, name)
+            }
+        }
+
+        if source == nil || len(d.Missing) == 0 && len(d.MastersDiffer) == 0 {
+            continue
+        }
+        d.Masters = source.Masters
+        res = append(res, d)
+
+        if !fix {
+            continue
+        }
+        for _, name := range d.Missing {
+            _, err := stores[name].AddZone(&bind.Zone{Name: zoneName, Masters: source.Masters}); if err != nil {
+                return res, fmt.Errorf("Failed to add %s to %s: %s", zoneName, name, err)
+            }
+            d.Fixed = append(d.Fixed, name)
+        }
+    }
+    return res, nil
+}
+
+// Build the request handler filters decide on for a zone found while reconciling. The remote group is the first
+// one containing a remote whose address or mapped masters are among the masters the zone has in the first handler
+// having it, or whose fixed masters are.
+func reconcileRequest(cfg *config.AppConfig, zoneName string, names []string,
+        sets map[string]map[string]*bind.Zone) *Request {
+    req := &Request{Zone: zoneName}
+    var zone *bind.Zone
+    for _, name := range names {
+        if zone = sets[name][zoneName]; zone != nil {
+            break
+        }
+    }
+
+    for i, g := range cfg.RemoteGroups {
+        candidates := append([]bind.Master{}, g.Masters...)
+        for _, r := range g.Remotes {
+            candidates = append(candidates, cfg.MastersOf(r)...)
+        }
+        for _, c := range candidates {
+            for _, m := range zone.Masters {
+                if c.Address == m.Address {
+                    req.Group = &cfg.RemoteGroups[i]
+                    return req
+                }
+            }
+        }
+    }
+    return req
+}
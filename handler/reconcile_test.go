@@ -0,0 +1,127 @@
+package handler
+
+import (
+    "testing"
+    "io/ioutil"
+    "path/filepath"
+
+    "github.com/op/go-logging"
+
+    "github.com/mandrakey/dnsync/bind"
+    "github.com/mandrakey/dnsync/config"
+)
+
+// Create a logger discarding all output.
+func testLogger() *logging.Logger {
+    log := logging.MustGetLogger("test")
+    log.SetBackend(logging.AddModuleLevel(logging.NewLogBackend(ioutil.Discard, "", 0)))
+    return log
+}
+
+// Create a bind handler name writing to a temporary directory.
+func testBindHandler(t *testing.T, name string) Handler {
+    dir := t.TempDir()
+    h, err := New(config.Handler{
+        Name: name,
+        Type: HANDLER_BIND,
+        BindHandler: config.BindHandler{
+            BindConfigFile: filepath.Join(dir, "dnsync.conf"),
+            BindZonefilesPath: dir,
+        },
+    }, testLogger())
+    if err != nil {
+        t.Fatalf("Failed to create handler: %s", err)
+    }
+    return h
+}
+
+func TestReconcile(t *testing.T) {
+    h1 := testBindHandler(t, "bind1")
+    h2 := testBindHandler(t, "bind2")
+    handlers := []Handler{h1, h2}
+
+    h1.(ZoneStore).AddZone(&bind.Zone{Name: "both.tld", Masters: bind.MastersFrom("1.2.3.4")})
+    h2.(ZoneStore).AddZone(&bind.Zone{Name: "both.tld", Masters: bind.MastersFrom("1.2.3.4")})
+    h1.(ZoneStore).AddZone(&bind.Zone{Name: "first.tld", Masters: bind.MastersFrom("1.2.3.4")})
+    h2.(ZoneStore).AddZone(&bind.Zone{Name: "second.tld", Masters: bind.MastersFrom("5.6.7.8")})
+    h1.(ZoneStore).AddZone(&bind.Zone{Name: "masters.tld", Masters: bind.MastersFrom("1.2.3.4")})
+    h2.(ZoneStore).AddZone(&bind.Zone{Name: "masters.tld", Masters: bind.MastersFrom("5.6.7.8")})
+
+    drifts, err := Reconcile(&config.AppConfig{}, handlers, false); if err != nil {
+        t.Fatalf("Failed to reconcile: %s", err)
+    }
+    if len(drifts) != 3 {
+        t.Fatalf("Expected 3 drifts, got %d: %v", len(drifts), drifts)
+    }
+    expected := []string{
+        "first.tld (source bind1): missing in bind2",
+        "masters.tld (source bind1): masters differ in bind2",
+        "second.tld (source bind2): missing in bind1",
+    }
+    for i, e := range expected {
+        if drifts[i].String() != e {
+            t.Fatalf("Drift reported wrong.\nExpect: %s\nActual: %s", e, drifts[i].String())
+        }
+    }
+
+    drifts, err = Reconcile(&config.AppConfig{}, handlers, true); if err != nil {
+        t.Fatalf("Failed to reconcile: %s", err)
+    }
+    if drifts[0].String() != "first.tld (source bind1): missing in bind2; re-added to bind2" {
+        t.Fatalf("Fix not reported: %s", drifts[0].String())
+    }
+    if !bind.SameMasters(drifts[0].Masters, bind.MastersFrom("1.2.3.4")) {
+        t.Fatalf("Masters of the source not reported: %v", drifts[0].Masters)
+    }
+
+    zones, _ := h1.(ZoneStore).Zones()
+    if len(zones) != 4 {
+        t.Fatalf("Missing zone not re-added to bind1: %v", zones)
+    }
+
+    drifts, _ = Reconcile(&config.AppConfig{}, handlers, false)
+    if len(drifts) != 1 || drifts[0].Zone != "masters.tld" {
+        t.Fatalf("Only differing masters should remain after fixing: %v", drifts)
+    }
+}
+
+func TestReconcileFilters(t *testing.T) {
+    dir := t.TempDir()
+    cfg := &config.AppConfig{RemoteGroups: []config.RemoteGroup{{Name: "customers", Remotes: []string{"5.6.7.8"}}}}
+    all := testBindHandler(t, "all")
+    internal, err := New(config.Handler{
+        Name: "internal",
+        Type: HANDLER_BIND,
+        Filter: config.Filter{Include: []string{"internal.tld"}},
+        BindHandler: config.BindHandler{BindConfigFile: filepath.Join(dir, "internal.conf"), BindZonefilesPath: dir},
+    }, testLogger())
+    if err != nil {
+        t.Fatalf("Failed to create handler: %s", err)
+    }
+    customers, err := New(config.Handler{
+        Name: "customers",
+        Type: HANDLER_BIND,
+        Filter: config.Filter{RemoteGroups: []string{"customers"}},
+        BindHandler: config.BindHandler{BindConfigFile: filepath.Join(dir, "customers.conf"), BindZonefilesPath: dir},
+    }, testLogger())
+    if err != nil {
+        t.Fatalf("Failed to create handler: %s", err)
+    }
+    handlers := []Handler{all, internal, customers}
+
+    all.(ZoneStore).AddZone(&bind.Zone{Name: "a.internal.tld", Masters: bind.MastersFrom("1.2.3.4")})
+    internal.(ZoneStore).AddZone(&bind.Zone{Name: "a.internal.tld", Masters: bind.MastersFrom("1.2.3.4")})
+    all.(ZoneStore).AddZone(&bind.Zone{Name: "customer.tld", Masters: bind.MastersFrom("5.6.7.8")})
+    internal.(ZoneStore).AddZone(&bind.Zone{Name: "stale.tld", Masters: bind.MastersFrom("1.2.3.4")})
+
+    drifts, err := Reconcile(cfg, handlers, true); if err != nil {
+        t.Fatalf("Failed to reconcile: %s", err)
+    }
+    if len(drifts) != 1 || drifts[0].String() != "customer.tld (source all): missing in customers; re-added to customers" {
+        t.Fatalf("Filters not respected: %v", drifts)
+    }
+    zones, _ := internal.(ZoneStore).Zones()
+    if len(zones) != 2 {
+        t.Fatalf("Zones added to a handler whose filter rejects them: %v", zones)
+    }
+}
@@ -0,0 +1,181 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package handler
+
+import (
+    "fmt"
+    "net"
+    "sync"
+    "time"
+    "strings"
+
+    "github.com/miekg/dns"
+    "github.com/op/go-logging"
+
+    "github.com/mandrakey/dnsync/config"
+)
+
+// Defaults of unset relay handler configuration values.
+const (
+    DEFAULT_RELAY_TIMEOUT = 5 * time.Second
+    DEFAULT_RELAY_BACKOFF = time.Second
+)
+
+// Handler re-sending every NOTIFY to a list of downstream name servers.
+type relayHandler struct {
+    cfg config.Handler
+    log *logging.Logger
+    filter *filter
+    // Targets as host:port
+    targets []string
+    tsig *config.TsigKey
+    timeout time.Duration
+    backoff time.Duration
+}
+
+// Check whether or not the handler is run for every NOTIFY, which it is, since every serial has to reach the
+// targets.
+func (h *relayHandler) Passthrough() bool {
+    return true
+}
+
+// Create a new relayHandler for a given handler configuration.
+func newRelayHandler(cfg config.Handler, log *logging.Logger) (*relayHandler, error) {
+    if len(cfg.RelayTargets) == 0 {
+        return nil, fmt.Errorf("Handler %s: at least one target is required", cfg.Name)
+    }
+
+    h := &relayHandler{cfg: cfg, log: log, timeout: DEFAULT_RELAY_TIMEOUT, backoff: DEFAULT_RELAY_BACKOFF}
+    for _, t := range cfg.RelayTargets {
+        target, err := relayTarget(t); if err != nil {
+            return nil, fmt.Errorf("Handler %s: %s", cfg.Name, err)
+        }
+        h.targets = append(h.targets, target)
+    }
+
+    var err error
+    if cfg.RelayTsig != "" {
+        h.tsig, err = config.ParseTsigKey(cfg.RelayTsig); if err != nil {
+            return nil, fmt.Errorf("Handler %s: %s", cfg.Name, err)
+        }
+    }
+    if cfg.RelayTimeout != "" {
+        h.timeout, err = time.ParseDuration(cfg.RelayTimeout); if err != nil {
+            return nil, fmt.Errorf("Handler %s: invalid target-timeout: %s", cfg.Name, err)
+        }
+    }
+    if cfg.RelayBackoff != "" {
+        h.backoff, err = time.ParseDuration(cfg.RelayBackoff); if err != nil {
+            return nil, fmt.Errorf("Handler %s: invalid backoff: %s", cfg.Name, err)
+        }
+    }
+
+    h.filter, err = newFilter(cfg.Filter); if err != nil {
+        return nil, fmt.Errorf("Handler %s: %s", cfg.Name, err)
+    }
+    return h, nil
+}
+
+// Get the address of a target given as host or host:port, using port 53 by default.
+func relayTarget(s string) (string, error) {
+    host, port, err := net.SplitHostPort(s); if err != nil {
+        host, port = s, "53"
+    }
+    if host == "" {
+        return "", fmt.Errorf("Invalid target %q", s)
+    }
+    return net.JoinHostPort(host, port), nil
+}
+
+// Get the configured name of this handler.
+func (h *relayHandler) Name() string {
+    return h.cfg.Name
+}
+
+// Handles a DNS NOTIFY packet by sending a NOTIFY for the same zone and serial to all targets at once. Targets
+// not answering within the timeout are retried. Fails if any target did not answer or did not answer with
+// NOERROR. Zones rejected by the handler's filter are skipped.
+func (h *relayHandler) HandleMessage(req *Request) (Action, error) {
+    if !filterRequest(h.filter, h.log, h.Name(), req) {
+        return ACTION_FILTERED, nil
+    }
+
+    msg := NewNotify(req.Zone, req.Serial)
+    errs := make([]string, 0)
+    mu := sync.Mutex{}
+    wg := sync.WaitGroup{}
+    for _, target := range h.targets {
+        wg.Add(1)
+        go func(target string) {
+            defer wg.Done()
+            err := h.relay(msg.Copy(), target, req.Fields().With(config.Fields{"handler": h.Name(), "target": target}))
+            if err != nil {
+                mu.Lock()
+                errs = append(errs, fmt.Sprintf("%s: %s", target, err))
+                mu.Unlock()
+            }
+        }(target)
+    }
+    wg.Wait()
+
+    if len(errs) > 0 {
+        return ACTION_ERROR, fmt.Errorf("Relaying to %d of %d targets failed: %s", len(errs), len(h.targets),
+            strings.Join(errs, "; "))
+    }
+    return ACTION_RELAYED, nil
+}
+
+// Send msg to target until it answers or the retries are used up, and log the result.
+func (h *relayHandler) relay(msg *dns.Msg, target string, fields config.Fields) error {
+    client := dns.Client{Net: "udp", Timeout: h.timeout}
+    if h.tsig != nil {
+        client.TsigSecret = h.tsig.Secrets()
+    }
+
+    delay := h.backoff
+    for attempt := 0; ; attempt++ {
+        if h.tsig != nil {
+            msg.SetTsig(h.tsig.Name, h.tsig.Algorithm, 300, time.Now().Unix())
+        }
+        res, rtt, err := client.Exchange(msg, target)
+        fields["attempt"] = attempt + 1
+
+        if err == nil {
+            fields["rcode"] = dns.RcodeToString[res.Rcode]
+            fields["rtt_ms"] = rtt.Nanoseconds() / int64(time.Millisecond)
+            if res.Rcode != dns.RcodeSuccess {
+                h.log.Warning(config.NewEvent("Relayed notify was not accepted", fields))
+                return fmt.Errorf("answered with %s", dns.RcodeToString[res.Rcode])
+            }
+            h.log.Info(config.NewEvent("Relayed notify", fields))
+            return nil
+        }
+
+        fields["error"] = err.Error()
+        if attempt >= h.cfg.RelayRetries {
+            h.log.Error(config.NewEvent("Failed to relay notify", fields))
+            return err
+        }
+        h.log.Warning(config.NewEvent(fmt.Sprintf("Relayed notify got no answer, retrying in %s", delay), fields))
+        delete(fields, "error")
+        time.Sleep(delay)
+        delay *= 2
+    }
+}
+
+// Create a NOTIFY for zone, carrying an SOA record with the given serial in its answer section.
+func NewNotify(zone string, serial uint32) *dns.Msg {
+    msg := new(dns.Msg)
+    msg.SetNotify(dns.Fqdn(zone))
+    msg.Answer = []dns.RR{&dns.SOA{
+        Hdr: dns.RR_Header{Name: dns.Fqdn(zone), Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 0},
+        Ns: dns.Fqdn(zone),
+        Mbox: dns.Fqdn("hostmaster." + zone),
+        Serial: serial,
+    }}
+    return msg
+}
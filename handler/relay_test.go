@@ -0,0 +1,140 @@
+package handler
+
+import (
+    "net"
+    "sync"
+    "testing"
+
+    "github.com/miekg/dns"
+
+    "github.com/mandrakey/dnsync/config"
+)
+
+const testTsigSecret = "c2VjcmV0c2VjcmV0c2VjcmV0"
+
+// A name server receiving relayed NOTIFYs. It ignores the first drop NOTIFYs and answers the rest with rcode.
+type downstream struct {
+    mu sync.Mutex
+    drop int
+    rcode int
+    received []*dns.Msg
+    tsigOK bool
+}
+
+// Record a NOTIFY and answer it, unless it is to be dropped.
+func (d *downstream) ServeDNS(w dns.ResponseWriter, msg *dns.Msg) {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+
+    d.received = append(d.received, msg)
+    d.tsigOK = msg.IsTsig() != nil && w.TsigStatus() == nil
+    if len(d.received) <= d.drop {
+        return
+    }
+    res := new(dns.Msg)
+    res.SetRcode(msg, d.rcode)
+    if msg.IsTsig() != nil {
+        res.SetTsig(msg.IsTsig().Hdr.Name, dns.HmacSHA256, 300, int64(msg.IsTsig().TimeSigned))
+    }
+    w.WriteMsg(res)
+}
+
+// Get the number of NOTIFYs received so far.
+func (d *downstream) count() int {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    return len(d.received)
+}
+
+// Start a downstream name server on a random local port and return its address.
+func startDownstream(t *testing.T, d *downstream) string {
+    conn, err := net.ListenPacket("udp", "127.0.0.1:0"); if err != nil {
+        t.Fatalf("Failed to listen: %s", err)
+    }
+    srv := &dns.Server{PacketConn: conn, Handler: d, TsigSecret: map[string]string{"relay.": testTsigSecret}}
+    started := make(chan struct{})
+    srv.NotifyStartedFunc = func() { close(started) }
+    go srv.ActivateAndServe()
+    <-started
+    t.Cleanup(func() { srv.Shutdown() })
+    return conn.LocalAddr().String()
+}
+
+// Create a relay handler configured by cfg sending to targets.
+func testRelayHandler(t *testing.T, cfg config.Handler, targets ...string) Handler {
+    cfg.Name, cfg.Type = "relay", HANDLER_RELAY
+    cfg.RelayTargets = targets
+    h, err := New(cfg, testLogger()); if err != nil {
+        t.Fatalf("Failed to create handler: %s", err)
+    }
+    return h
+}
+
+func TestRelay(t *testing.T) {
+    d1 := &downstream{}
+    d2 := &downstream{drop: 1}
+    h := testRelayHandler(t, config.Handler{
+        RelayHandler: config.RelayHandler{RelayTimeout: "200ms", RelayRetries: 2, RelayBackoff: "10ms",
+            RelayTsig: "relay:" + testTsigSecret},
+    }, startDownstream(t, d1), startDownstream(t, d2))
+
+    action, err := h.HandleMessage(execRequest()); if err != nil || action != ACTION_RELAYED {
+        t.Fatalf("Relaying was %s: %v", action, err)
+    }
+    if d1.count() != 1 || d2.count() != 2 {
+        t.Fatalf("Expected 1 and 2 NOTIFYs, got %d and %d", d1.count(), d2.count())
+    }
+
+    d1.mu.Lock()
+    defer d1.mu.Unlock()
+    msg := d1.received[0]
+    if msg.Opcode != dns.OpcodeNotify || msg.Question[0].Name != "domain.tld." ||
+            msg.Answer[0].(*dns.SOA).Serial != 42 {
+        t.Fatalf("Wrong NOTIFY relayed: %s", msg)
+    }
+    if !d1.tsigOK {
+        t.Fatalf("Relayed NOTIFY not signed correctly")
+    }
+}
+
+func TestRelayFailure(t *testing.T) {
+    silent := &downstream{drop: 10}
+    refusing := &downstream{rcode: dns.RcodeRefused}
+    ok := &downstream{}
+    h := testRelayHandler(t, config.Handler{
+        RelayHandler: config.RelayHandler{RelayTimeout: "100ms", RelayRetries: 1, RelayBackoff: "10ms"},
+    }, startDownstream(t, silent), startDownstream(t, refusing), startDownstream(t, ok))
+
+    action, err := h.HandleMessage(execRequest()); if err == nil || action != ACTION_ERROR {
+        t.Fatalf("Relaying to failing targets was %s", action)
+    }
+    if silent.count() != 2 || refusing.count() != 1 || ok.count() != 1 {
+        t.Fatalf("Wrong number of attempts: %d, %d, %d", silent.count(), refusing.count(), ok.count())
+    }
+}
+
+func TestRelayTarget(t *testing.T) {
+    for in, expect := range map[string]string{
+        "192.0.2.1": "192.0.2.1:53",
+        "192.0.2.1:5353": "192.0.2.1:5353",
+        "ns1.example.com": "ns1.example.com:53",
+        "2001:db8::1": "[2001:db8::1]:53",
+        "[2001:db8::1]:5353": "[2001:db8::1]:5353",
+    } {
+        got, err := relayTarget(in); if err != nil || got != expect {
+            t.Fatalf("Target %s parsed as %s (%v), expected %s", in, got, err, expect)
+        }
+    }
+
+    for _, cfg := range []config.Handler{
+        {},
+        {RelayHandler: config.RelayHandler{RelayTargets: []string{"192.0.2.1"}, RelayTsig: "nokey"}},
+        {RelayHandler: config.RelayHandler{RelayTargets: []string{"192.0.2.1"}, RelayBackoff: "1"}},
+        {RelayHandler: config.RelayHandler{RelayTargets: []string{":53"}}},
+    } {
+        cfg.Name, cfg.Type = "relay", HANDLER_RELAY
+        if _, err := New(cfg, testLogger()); err == nil {
+            t.Fatalf("Invalid relay handler %+v accepted", cfg)
+        }
+    }
+}
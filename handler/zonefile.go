@@ -0,0 +1,75 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package handler
+
+import (
+    "fmt"
+    "bytes"
+    "strings"
+    "text/template"
+
+    "golang.org/x/net/idna"
+)
+
+// Template for zone file paths used if a handler configures none, giving <zonefiles-path>/<zone>.host.
+const DEFAULT_ZONEFILE_TEMPLATE = "{{.Path}}/{{.Zone}}.host"
+
+// Data available in zone file templates.
+type zonefileData struct {
+    // The zonefiles-path of the handler
+    Path string
+    // The zone name, sanitized for use in file names
+    Zone string
+    // The zone name as notified, which may be unsafe in file names
+    Name string
+    // The first character of Zone, e.g. to spread zone files over subdirectories
+    FirstLetter string
+}
+
+// Parse the zone file template of a handler. An empty template means DEFAULT_ZONEFILE_TEMPLATE.
+func parseZonefileTemplate(text string) (*template.Template, error) {
+    if text == "" {
+        text = DEFAULT_ZONEFILE_TEMPLATE
+    }
+    tpl, err := template.New("zonefile").Option("missingkey=error").Parse(text); if err != nil {
+        return nil, fmt.Errorf("Invalid zonefile-template: %s", err)
+    }
+    return tpl, nil
+}
+
+// Build the zone file path of the zone name below path using tpl.
+func zonefilePath(tpl *template.Template, path, name string) (string, error) {
+    zone := sanitizeZoneName(name)
+    data := zonefileData{Path: path, Zone: zone, Name: name, FirstLetter: zone[:1]}
+
+    buf := &bytes.Buffer{}
+    err := tpl.Execute(buf, data); if err != nil {
+        return "", fmt.Errorf("Failed to build zone file path of %s: %s", name, err)
+    }
+    return buf.String(), nil
+}
+
+// Turn a zone name into a string that is safe to use as file name: IDNs are converted to their ASCII form, the
+// slash of classless reverse zones (RFC 2317) becomes a dash and any other character but letters, digits, dots,
+// dashes and underscores is replaced by an underscore. The result is never empty and does not start with a dot.
+func sanitizeZoneName(name string) string {
+    name = strings.ToLower(strings.TrimSuffix(name, "."))
+    if ascii, err := idna.ToASCII(name); err == nil {
+        name = ascii
+    }
+
+    res := []byte(strings.Replace(name, "/", "-", -1))
+    for i, c := range res {
+        if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+            res[i] = '_'
+        }
+    }
+    if len(res) == 0 || res[0] == '.' {
+        res = append([]byte{'_'}, res...)
+    }
+    return string(res)
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+    "os"
+    "testing"
+    "path/filepath"
+
+    "github.com/mandrakey/dnsync/bind"
+    "github.com/mandrakey/dnsync/config"
+)
+
+func TestSanitizeZoneName(t *testing.T) {
+    tests := map[string]string{
+        "Example.COM.": "example.com",
+        "2.0.192.in-addr.arpa": "2.0.192.in-addr.arpa",
+        "0/25.2.0.192.in-addr.arpa": "0-25.2.0.192.in-addr.arpa",
+        "bücher.example": "xn--bcher-kva.example",
+        "../etc/passwd": "_..-etc-passwd",
+        "a b;c": "a_b_c",
+        "": "_",
+    }
+
+    for name, expect := range tests {
+        if res := sanitizeZoneName(name); res != expect {
+            t.Errorf("sanitizeZoneName(%q) = %q, expected %q", name, res, expect)
+        }
+    }
+}
+
+func TestZonefilePath(t *testing.T) {
+    tests := []struct {
+        template string
+        name string
+        expect string
+    }{
+        {"", "domain.tld", "/var/lib/bind/domain.tld.host"},
+        {"{{.Path}}/{{.FirstLetter}}/db.{{.Zone}}", "Domain.tld", "/var/lib/bind/d/db.domain.tld"},
+        {"{{.Path}}/{{.FirstLetter}}/db.{{.Zone}}", "0/25.2.0.192.in-addr.arpa", "/var/lib/bind/0/db.0-25.2.0.192.in-addr.arpa"},
+    }
+
+    for _, test := range tests {
+        tpl, err := parseZonefileTemplate(test.template); if err != nil {
+            t.Fatalf("Failed to parse %q: %s", test.template, err)
+        }
+        res, err := zonefilePath(tpl, "/var/lib/bind", test.name); if err != nil || res != test.expect {
+            t.Errorf("Template %q for %s gave %q (%v), expected %q", test.template, test.name, res, err, test.expect)
+        }
+    }
+
+    if _, err := parseZonefileTemplate("{{.Path"); err == nil {
+        t.Fatal("Invalid template was parsed without error")
+    }
+    tpl, _ := parseZonefileTemplate("{{.Unknown}}")
+    if _, err := zonefilePath(tpl, "/var/lib/bind", "domain.tld"); err == nil {
+        t.Fatal("Template with unknown field was executed without error")
+    }
+}
+
+func TestBindHandlerZonefileTemplate(t *testing.T) {
+    dir := t.TempDir()
+    h, err := New(config.Handler{
+        Name: "bind",
+        Type: HANDLER_BIND,
+        BindHandler: config.BindHandler{
+            BindConfigFile: filepath.Join(dir, "dnsync.conf"),
+            BindZonefilesPath: dir,
+            BindZonefileTemplate: "{{.Path}}/{{.FirstLetter}}/db.{{.Zone}}",
+        },
+    }, testLogger())
+    if err != nil {
+        t.Fatalf("Failed to create handler: %s", err)
+    }
+
+    _, err = h.(ZoneStore).AddZone(&bind.Zone{Name: "domain.tld", Masters: bind.MastersFrom("1.2.3.4")}); if err != nil {
+        t.Fatalf("Failed to add zone: %s", err)
+    }
+    zones, _ := h.(ZoneStore).Zones()
+    if len(zones) != 1 || zones[0].File != filepath.Join(dir, "d", "db.domain.tld") {
+        t.Fatalf("Zone file not built from template: %v", zones)
+    }
+    if info, err := os.Stat(filepath.Join(dir, "d")); err != nil || !info.IsDir() {
+        t.Fatalf("Zone file directory was not created")
+    }
+
+    _, err = New(config.Handler{Name: "bind", Type: HANDLER_BIND,
+        BindHandler: config.BindHandler{BindZonefileTemplate: "{{.Path"}}, testLogger())
+    if err == nil {
+        t.Fatal("Handler with invalid template was created")
+    }
+}
+
+func TestBindHandlerKeepsZonefile(t *testing.T) {
+    dir := t.TempDir()
+    h, err := New(config.Handler{
+        Name: "bind",
+        Type: HANDLER_BIND,
+        MaxZones: 1,
+        BindHandler: config.BindHandler{
+            BindConfigFile: filepath.Join(dir, "dnsync.conf"),
+            BindZonefilesPath: dir,
+            BindZonefileTemplate: "{{.Path}}/{{.FirstLetter}}/db.{{.Zone}}",
+        },
+    }, testLogger())
+    if err != nil {
+        t.Fatalf("Failed to create handler: %s", err)
+    }
+
+    file := filepath.Join(dir, "imported", "domain.tld.zone")
+    _, err = h.(ZoneStore).AddZone(&bind.Zone{Name: "domain.tld", Masters: bind.MastersFrom("1.2.3.4"), File: file})
+    if err != nil {
+        t.Fatalf("Failed to add zone: %s", err)
+    }
+    action, err := h.HandleMessage(quotaRequest("domain.tld", "192.0.2.1")); if err != nil || action != ACTION_UPDATED {
+        t.Fatalf("NOTIFY not handled: %s, %v", action, err)
+    }
+    zones, _ := h.(ZoneStore).Zones()
+    if len(zones) != 1 || zones[0].File != file {
+        t.Fatalf("Zone file of notified zone was changed: %v", zones)
+    }
+
+    action, _ = h.HandleMessage(quotaRequest("other.tld", "192.0.2.1")); if action != ACTION_REFUSED {
+        t.Fatalf("Zone over quota not refused: %s", action)
+    }
+    if _, err := os.Stat(filepath.Join(dir, "o")); !os.IsNotExist(err) {
+        t.Fatal("Zone file directory of refused zone was created")
+    }
+}
+
+// Any name accepted by bind.NormalizeZoneName must result in a zone file below the zonefiles path and in a bind
+// configuration containing exactly that zone.
+func FuzzZoneName(f *testing.F) {
+    for _, seed := range []string{"domain.tld", "Bücher.example.", "0/25.2.0.192.in-addr.arpa", "../../etc/passwd",
+            "a\"; }; zone \"b", "..", "/", "_.-", "a..b"} {
+        f.Add(seed)
+    }
+    tpl, err := parseZonefileTemplate("{{.Path}}/{{.FirstLetter}}/db.{{.Zone}}"); if err != nil {
+        f.Fatalf("Failed to parse template: %s", err)
+    }
+
+    f.Fuzz(func(t *testing.T, name string) {
+        zone, err := bind.NormalizeZoneName(name); if err != nil {
+            return
+        }
+
+        file, err := zonefilePath(tpl, "/var/lib/bind", zone); if err != nil {
+            t.Fatalf("Failed to build path of %q: %s", zone, err)
+        }
+        if filepath.Clean(file) != file || filepath.Dir(filepath.Dir(file)) != "/var/lib/bind" {
+            t.Fatalf("Path of %q leaves the zonefiles path: %s", zone, file)
+        }
+
+        bc := bind.NewBindConfig()
+        bc.AddZone(&bind.Zone{Name: zone, Masters: bind.MastersFrom("192.0.2.1"), File: file})
+        conf := filepath.Join(t.TempDir(), "dnsync.conf")
+        err = bc.Save(conf); if err != nil {
+            t.Fatalf("Failed to save %q: %s", zone, err)
+        }
+
+        bc2 := bind.NewBindConfig()
+        err = bc2.Load(conf); if err != nil {
+            t.Fatalf("Saved config of %q cannot be loaded: %s", zone, err)
+        }
+        zones := bc2.Zones()
+        if len(zones) != 1 || zones[0].Name != zone || zones[0].File != file {
+            t.Fatalf("Saved config of %q does not contain exactly that zone: %v", zone, zones)
+        }
+    })
+}
@@ -0,0 +1,141 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package main
+
+import (
+    "io"
+    "os"
+    "fmt"
+
+    "github.com/mandrakey/dnsync/bind"
+    "github.com/mandrakey/dnsync/handler"
+    "github.com/mandrakey/dnsync/tools"
+
+    "github.com/urfave/cli"
+)
+
+// Zone types that are imported; all others are skipped.
+var importTypes = []string{"slave", "secondary"}
+
+// Import existing slave zones from a bind configuration file into a handler, so dnsync manages them from now on.
+var importCommand = cli.Command{
+    Name: "import",
+    Usage: "Import slave zones from a bind configuration file",
+    Flags: []cli.Flag{
+        cli.StringFlag{
+            Name: "from",
+            Usage: "Read zones from `FILE`, e.g. /etc/bind/named.conf.local",
+        },
+        handlerFlag,
+        cli.BoolFlag{
+            Name: "overwrite",
+            Usage: "Replace zones the handler already has with different masters or file",
+        },
+        cli.BoolFlag{
+            Name: "dry-run, n",
+            Usage: "Only report what would be imported",
+        },
+    },
+    Action: actionImport,
+}
+
+// Import all slave zones and report added, unchanged, conflicting and skipped zones.
+func actionImport(c *cli.Context) error {
+    if c.String("from") == "" {
+        return fmt.Errorf("--from is required")
+    }
+
+    source := bind.NewBindConfig()
+    err := source.Load(c.String("from")); if err != nil {
+        return err
+    }
+
+    handlerName, store, err := selectNamedZoneStore(c); if err != nil {
+        return err
+    }
+    hooks, err := loadHooks(); if err != nil {
+        return err
+    }
+    defer hooks.Wait()
+
+    counts, err := importZones(os.Stdout, source.Zones(), store, c.Bool("overwrite"), c.Bool("dry-run"),
+        func(zone *bind.Zone, action handler.Action) {
+            sendZoneEvent(hooks, handlerName, zone, action)
+        })
+    if err != nil {
+        return err
+    }
+
+    if c.Bool("dry-run") {
+        fmt.Printf("\n%d to import, ", counts["import"])
+    } else {
+        fmt.Printf("\n%d added, %d updated, ", counts[string(handler.ACTION_ADDED)], counts[string(handler.ACTION_UPDATED)])
+    }
+    fmt.Printf("%d unchanged, %d conflicts, %d skipped\n", counts["unchanged"], counts["conflict"], counts["skipped"])
+    if counts["conflict"] > 0 {
+        return fmt.Errorf("%d zones conflict with existing ones, use --overwrite to replace them", counts["conflict"])
+    }
+    return nil
+}
+
+// Import the slave zones among zones into store, writing a line per zone to w, and return the number of zones per
+// outcome. Zone names are normalized like those of NOTIFYs, so imported zones match them; zones with invalid names
+// are skipped. Unless overwrite is set, zones the store has with different masters or file are left alone as
+// conflicts. changed is called with the action of every zone passed to the store.
+func importZones(w io.Writer, zones []*bind.Zone, store handler.ZoneStore, overwrite, dryRun bool,
+        changed func(*bind.Zone, handler.Action)) (map[string]int, error) {
+    current, err := store.Zones(); if err != nil {
+        return nil, err
+    }
+    existing := make(map[string]*bind.Zone)
+    for _, zone := range current {
+        existing[zone.Name] = zone
+    }
+
+    counts := make(map[string]int)
+    for _, zone := range zones {
+        if !tools.StringInSlice(zone.Type, importTypes) {
+            fmt.Fprintf(w, "skipped   %s: type %s\n", zone.Name, zone.Type)
+            counts["skipped"]++
+            continue
+        }
+        name, err := bind.NormalizeZoneName(zone.Name); if err != nil {
+            fmt.Fprintf(w, "skipped   %s: %s\n", zone.Name, err)
+            counts["skipped"]++
+            continue
+        }
+        zone.Name = name
+
+        old, ok := existing[zone.Name]
+        switch {
+        case ok && old.Equals(zone):
+            fmt.Fprintf(w, "unchanged %s\n", zone.Name)
+            counts["unchanged"]++
+            continue
+
+        case ok && !overwrite:
+            fmt.Fprintf(w, "conflict  %s: have masters [%s] file %s, import has masters [%s] file %s\n", zone.Name,
+                bind.JoinMasters(old.Masters, ", "), old.File, bind.JoinMasters(zone.Masters, ", "), zone.File)
+            counts["conflict"]++
+            continue
+        }
+
+        if dryRun {
+            fmt.Fprintf(w, "import    %s\n", zone.Name)
+            counts["import"]++
+            continue
+        }
+
+        action, err := store.AddZone(zone); if err != nil {
+            return nil, fmt.Errorf("Failed to import %s: %s", zone.Name, err)
+        }
+        fmt.Fprintf(w, "%-9s %s\n", action, zone.Name)
+        counts[string(action)]++
+        changed(zone, action)
+    }
+    return counts, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+    "io/ioutil"
+    "path/filepath"
+
+    "github.com/op/go-logging"
+
+    "github.com/mandrakey/dnsync/bind"
+    "github.com/mandrakey/dnsync/config"
+    "github.com/mandrakey/dnsync/handler"
+)
+
+func TestImportZonesNormalizesNames(t *testing.T) {
+    dir := t.TempDir()
+    log := logging.MustGetLogger("test")
+    log.SetBackend(logging.AddModuleLevel(logging.NewLogBackend(ioutil.Discard, "", 0)))
+    h, err := handler.New(config.Handler{
+        Name: "bind",
+        Type: handler.HANDLER_BIND,
+        BindHandler: config.BindHandler{BindConfigFile: filepath.Join(dir, "dnsync.conf"), BindZonefilesPath: dir},
+    }, log)
+    if err != nil {
+        t.Fatalf("Failed to create handler: %s", err)
+    }
+    store := h.(handler.ZoneStore)
+    _, err = store.AddZone(&bind.Zone{Name: "example.com", Masters: bind.MastersFrom("192.0.2.1"), File: "db.example.com"})
+    if err != nil {
+        t.Fatalf("Failed to add zone: %s", err)
+    }
+
+    source := bind.NewBindConfig()
+    err = source.Read(strings.NewReader(`
+zone "Example.COM." { type slave; masters { 192.0.2.1; }; file "db.example.com"; };
+zone "New.Example." { type slave; masters { 192.0.2.1; }; file "db.new.example"; };
+zone "-invalid.example" { type slave; masters { 192.0.2.1; }; file "db.invalid.example"; };
+`))
+    if err != nil {
+        t.Fatalf("Failed to read source: %s", err)
+    }
+
+    out := &bytes.Buffer{}
+    counts, err := importZones(out, source.Zones(), store, false, false, func(*bind.Zone, handler.Action) {})
+    if err != nil {
+        t.Fatalf("Import failed: %s", err)
+    }
+    if counts["unchanged"] != 1 || counts[string(handler.ACTION_ADDED)] != 1 || counts["skipped"] != 1 ||
+            counts["conflict"] != 0 {
+        t.Fatalf("Wrong import result %v:\n%s", counts, out)
+    }
+
+    zones, _ := store.Zones()
+    if len(zones) != 2 || zones[0].Name != "example.com" || zones[1].Name != "new.example" {
+        t.Fatalf("Zones not imported with normalized names: %v", zones)
+    }
+}
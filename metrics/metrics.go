@@ -0,0 +1,124 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package metrics
+
+import (
+    "net/http"
+
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Reasons for rejecting a received packet.
+const (
+    REASON_INVALID_REMOTE = "invalid_remote"
+    REASON_MALFORMED = "malformed"
+    REASON_NOT_NOTIFY = "not_notify"
+    REASON_INVALID_ZONE = "invalid_zone"
+)
+
+// Reasons for dropping a received packet without looking at it.
+const (
+    REASON_RATE_LIMITED = "rate_limited"
+    REASON_QUEUE_FULL = "queue_full"
+)
+
+// The Prometheus metrics of a single dnsync server. Every instance has its own registry, so several servers can
+// be run side by side.
+type Metrics struct {
+    registry *prometheus.Registry
+
+    // Number of packets received on the NOTIFY listener
+    NotifiesReceived prometheus.Counter
+    // Number of packets rejected before reaching any handler, by reason
+    NotifiesRejected *prometheus.CounterVec
+    // Number of packets dropped by flood protection, by reason
+    PacketsDropped *prometheus.CounterVec
+    // Number of repeated NOTIFYs answered without involving the handlers
+    NotifiesCoalesced prometheus.Counter
+    // Number of NOTIFYs for unknown zones queued for approval
+    NotifiesPending prometheus.Counter
+    // Number of NOTIFYs for known zones answered without involving the handlers
+    NotifiesSkipped prometheus.Counter
+    // Number of NOTIFYs processed by handlers, by handler and result
+    NotifiesHandled *prometheus.CounterVec
+    // Time handlers take to process a NOTIFY, by handler
+    HandlerDuration *prometheus.HistogramVec
+}
+
+// Create a new Metrics instance with all metrics registered.
+func New() *Metrics {
+    m := &Metrics{
+        registry: prometheus.NewRegistry(),
+        NotifiesReceived: prometheus.NewCounter(prometheus.CounterOpts{
+            Namespace: "dnsync",
+            Name: "notifies_received_total",
+            Help: "Number of packets received on the NOTIFY listener.",
+        }),
+        NotifiesRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Namespace: "dnsync",
+            Name: "notifies_rejected_total",
+            Help: "Number of packets rejected before reaching any handler.",
+        }, []string{"reason"}),
+        PacketsDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Namespace: "dnsync",
+            Name: "packets_dropped_total",
+            Help: "Number of packets dropped by flood protection.",
+        }, []string{"reason"}),
+        NotifiesCoalesced: prometheus.NewCounter(prometheus.CounterOpts{
+            Namespace: "dnsync",
+            Name: "notifies_coalesced_total",
+            Help: "Number of repeated NOTIFYs answered without involving the handlers.",
+        }),
+        NotifiesPending: prometheus.NewCounter(prometheus.CounterOpts{
+            Namespace: "dnsync",
+            Name: "notifies_pending_total",
+            Help: "Number of NOTIFYs for unknown zones queued for approval.",
+        }),
+        NotifiesSkipped: prometheus.NewCounter(prometheus.CounterOpts{
+            Namespace: "dnsync",
+            Name: "notifies_skipped_total",
+            Help: "Number of NOTIFYs for known zones answered without involving the handlers.",
+        }),
+        NotifiesHandled: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Namespace: "dnsync",
+            Name: "notifies_handled_total",
+            Help: "Number of NOTIFYs processed by handlers.",
+        }, []string{"handler", "result"}),
+        HandlerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+            Namespace: "dnsync",
+            Name: "handler_duration_seconds",
+            Help: "Time handlers take to process a NOTIFY.",
+            Buckets: prometheus.DefBuckets,
+        }, []string{"handler"}),
+    }
+
+    m.registry.MustRegister(m.NotifiesReceived, m.NotifiesRejected, m.PacketsDropped, m.NotifiesCoalesced,
+        m.NotifiesPending, m.NotifiesSkipped, m.NotifiesHandled, m.HandlerDuration)
+    return m
+}
+
+// Register a gauge reporting the number of zones managed by handler. count is called on every scrape; if it fails,
+// the gauge reports -1.
+func (m *Metrics) RegisterZoneCount(handler string, count func() (int, error)) error {
+    return m.registry.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+        Namespace: "dnsync",
+        Name: "zones",
+        Help: "Number of zones managed by a handler.",
+        ConstLabels: prometheus.Labels{"handler": handler},
+    }, func() float64 {
+        n, err := count(); if err != nil {
+            return -1
+        }
+        return float64(n)
+    }))
+}
+
+// Get an http.Handler serving the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+    return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
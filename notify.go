@@ -0,0 +1,84 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package main
+
+import (
+    "fmt"
+    "time"
+
+    "github.com/mandrakey/dnsync/config"
+    "github.com/mandrakey/dnsync/handler"
+
+    "github.com/urfave/cli"
+    "github.com/miekg/dns"
+)
+
+// Send a NOTIFY to a name server or a running dnsync, e.g. to debug firewall or ACL issues.
+var notifyCommand = cli.Command{
+    Name: "notify",
+    Usage: "Send a NOTIFY for a zone and print the reply",
+    Flags: []cli.Flag{
+        cli.StringFlag{
+            Name: "server, s",
+            Usage: "Send the NOTIFY to `HOST:PORT`",
+        },
+        cli.StringFlag{
+            Name: "zone, z",
+            Usage: "Notify about `ZONE`",
+        },
+        cli.UintFlag{
+            Name: "serial",
+            Value: 1,
+            Usage: "Put `SERIAL` into the SOA record of the NOTIFY",
+        },
+        cli.StringFlag{
+            Name: "tsig",
+            Usage: "Sign the NOTIFY with `KEY`, given as name:secret or algorithm:name:secret",
+        },
+        cli.BoolFlag{
+            Name: "tcp",
+            Usage: "Send via TCP instead of UDP",
+        },
+        cli.DurationFlag{
+            Name: "timeout",
+            Value: 5 * time.Second,
+            Usage: "Wait `DURATION` for the reply",
+        },
+    },
+    Action: actionNotify,
+}
+
+// Build a NOTIFY, send it and print rcode and round trip time of the reply.
+func actionNotify(c *cli.Context) error {
+    if c.String("server") == "" || c.String("zone") == "" {
+        return fmt.Errorf("--server and --zone are required")
+    }
+
+    msg := handler.NewNotify(c.String("zone"), uint32(c.Uint("serial")))
+    client := dns.Client{Net: "udp", Timeout: c.Duration("timeout")}
+    if c.Bool("tcp") {
+        client.Net = "tcp"
+    }
+
+    if c.String("tsig") != "" {
+        key, err := config.ParseTsigKey(c.String("tsig")); if err != nil {
+            return err
+        }
+        client.TsigSecret = key.Secrets()
+        msg.SetTsig(key.Name, key.Algorithm, 300, time.Now().Unix())
+    }
+
+    res, rtt, err := client.Exchange(msg, c.String("server")); if err != nil {
+        return fmt.Errorf("Failed to send NOTIFY to %s: %s", c.String("server"), err)
+    }
+
+    fmt.Printf("Reply from %s via %s: %s in %s\n", c.String("server"), client.Net, dns.RcodeToString[res.Rcode], rtt)
+    if res.Rcode != dns.RcodeSuccess {
+        return fmt.Errorf("NOTIFY was answered with %s", dns.RcodeToString[res.Rcode])
+    }
+    return nil
+}
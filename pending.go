@@ -0,0 +1,129 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package main
+
+import (
+    "os"
+    "fmt"
+    "time"
+    "text/tabwriter"
+
+    "github.com/mandrakey/dnsync/config"
+    "github.com/mandrakey/dnsync/handler"
+    "github.com/mandrakey/dnsync/server"
+    "github.com/mandrakey/dnsync/state"
+    "github.com/mandrakey/dnsync/webhook"
+
+    "github.com/urfave/cli"
+)
+
+// Administration of the zones waiting for approval. The queue lives in the pending bucket of the state-file, so
+// these commands require one, see loadPendingState.
+var pendingCommand = cli.Command{
+    Name: "pending",
+    Usage: "List, approve and reject zones waiting for approval",
+    Subcommands: []cli.Command{
+        {
+            Name: "list",
+            Usage: "List all pending zones",
+            Action: actionPendingList,
+        },
+        {
+            Name: "approve",
+            Usage: "Pass a pending zone to all handlers",
+            ArgsUsage: "<zone>",
+            Action: actionPendingApprove,
+        },
+        {
+            Name: "reject",
+            Usage: "Drop a pending zone",
+            ArgsUsage: "<zone>",
+            Action: actionPendingReject,
+        },
+    },
+}
+
+// List all zones waiting for approval.
+func actionPendingList(c *cli.Context) error {
+    store, err := loadPendingState(); if err != nil {
+        return err
+    }
+    defer store.Close()
+
+    pending, err := store.ListPending(time.Now().UTC()); if err != nil {
+        return err
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "ZONE\tREMOTE\tSERIAL\tFIRST SEEN\tLAST NOTIFY\tEXPIRES")
+    for _, p := range pending {
+        fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", p.Zone, p.Remote, p.Serial, p.FirstSeen.Format(time.RFC3339),
+            p.LastNotify.Format(time.RFC3339), p.Expires.Format(time.RFC3339))
+    }
+    return w.Flush()
+}
+
+// Approve a pending zone, passing it to all handlers like a regular NOTIFY.
+func actionPendingApprove(c *cli.Context) error {
+    name, err := zoneArg(c); if err != nil {
+        return err
+    }
+    cfg, err := loadConfig(); if err != nil {
+        return err
+    }
+    store, err := loadPendingState(); if err != nil {
+        return err
+    }
+    defer store.Close()
+
+    log := config.NewLogger(cfg)
+    handlers, err := handler.NewAll(cfg, log); if err != nil {
+        return err
+    }
+    hooks, err := webhook.New(cfg.Webhooks, log); if err != nil {
+        return err
+    }
+    err = server.New(cfg, handlers, store, hooks, log).Approve(name); if err != nil {
+        return err
+    }
+    fmt.Printf("%s: approved\n", name)
+    return nil
+}
+
+// Reject a pending zone. A later NOTIFY queues it again.
+func actionPendingReject(c *cli.Context) error {
+    name, err := zoneArg(c); if err != nil {
+        return err
+    }
+    store, err := loadPendingState(); if err != nil {
+        return err
+    }
+    defer store.Close()
+
+    p, err := store.GetPending(name, time.Now().UTC()); if err != nil {
+        return err
+    }
+    if p == nil {
+        return fmt.Errorf("No pending zone: %s", name)
+    }
+    err = store.DeletePending(name); if err != nil {
+        return err
+    }
+    fmt.Printf("%s: rejected\n", name)
+    return nil
+}
+
+// Open the state file holding the pending zones. Without a state file, zones cannot wait for approval.
+func loadPendingState() (state.Store, error) {
+    cfg, err := loadConfig(); if err != nil {
+        return nil, err
+    }
+    if cfg.StateFile == "" {
+        return nil, fmt.Errorf("Pending zones are only kept with a state-file")
+    }
+    return state.Open(cfg.StateFile)
+}
@@ -0,0 +1,69 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package main
+
+import (
+    "fmt"
+
+    "github.com/mandrakey/dnsync/bind"
+    "github.com/mandrakey/dnsync/config"
+    "github.com/mandrakey/dnsync/handler"
+    "github.com/mandrakey/dnsync/webhook"
+
+    "github.com/urfave/cli"
+)
+
+// Compare the zone sets of all handlers and report, or fix, the differences.
+var reconcileCommand = cli.Command{
+    Name: "reconcile",
+    Usage: "Compare the zones of all handlers and report drift",
+    Flags: []cli.Flag{
+        cli.BoolFlag{
+            Name: "fix",
+            Usage: "Re-add zones to the handlers missing them",
+        },
+    },
+    Action: actionReconcile,
+}
+
+// Print all zones that differ between handlers. Fails if any drift remains.
+func actionReconcile(c *cli.Context) error {
+    cfg, err := loadConfig(); if err != nil {
+        return err
+    }
+    handlers, err := handler.NewAll(cfg, config.NewLogger(cfg)); if err != nil {
+        return err
+    }
+
+    hooks, err := webhook.New(cfg.Webhooks, config.NewLogger(cfg)); if err != nil {
+        return err
+    }
+    defer hooks.Wait()
+
+    drifts, err := handler.Reconcile(cfg, handlers, c.Bool("fix"))
+    for _, d := range drifts {
+        fmt.Println(d.String())
+        for _, name := range d.Fixed {
+            sendZoneEvent(hooks, name, &bind.Zone{Name: d.Zone, Masters: d.Masters}, handler.ACTION_ADDED)
+        }
+    }
+    if err != nil {
+        return err
+    }
+
+    remaining := 0
+    for _, d := range drifts {
+        if len(d.Fixed) < len(d.Missing) || len(d.MastersDiffer) > 0 {
+            remaining++
+        }
+    }
+    if remaining > 0 {
+        return fmt.Errorf("%d zones differ between handlers", remaining)
+    }
+    fmt.Println("All handlers are in sync.")
+    return nil
+}
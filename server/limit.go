@@ -0,0 +1,139 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package server
+
+import (
+    "sync"
+    "time"
+)
+
+// Token bucket rate limiter keeping one bucket per source. Every bucket holds up to burst tokens and is refilled
+// with rate tokens per second; a packet takes one token.
+type rateLimiter struct {
+    rate float64
+    burst float64
+
+    mu sync.Mutex
+    buckets map[string]*bucket
+    lastPrune time.Time
+}
+
+// A single token bucket.
+type bucket struct {
+    tokens float64
+    last time.Time
+}
+
+// Create a rate limiter allowing rate packets per second with bursts of up to burst packets per source. A rate of
+// 0 or less disables rate limiting.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+    if burst < 1 {
+        burst = 1
+    }
+    return &rateLimiter{rate: rate, burst: float64(burst), buckets: make(map[string]*bucket)}
+}
+
+// Check whether or not a packet from source received at now may be processed, and take a token if so.
+func (l *rateLimiter) allow(source string, now time.Time) bool {
+    if l.rate <= 0 {
+        return true
+    }
+
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.prune(now)
+
+    b, ok := l.buckets[source]; if !ok {
+        b = &bucket{tokens: l.burst, last: now}
+        l.buckets[source] = b
+    }
+    b.tokens += now.Sub(b.last).Seconds() * l.rate
+    if b.tokens > l.burst {
+        b.tokens = l.burst
+    }
+    b.last = now
+
+    if b.tokens < 1 {
+        return false
+    }
+    b.tokens--
+    return true
+}
+
+// Forget buckets that are full again, so spoofed source addresses do not pile up. Runs at most once a minute.
+func (l *rateLimiter) prune(now time.Time) {
+    if now.Sub(l.lastPrune) < time.Minute {
+        return
+    }
+    l.lastPrune = now
+
+    for source, b := range l.buckets {
+        if b.tokens + now.Sub(b.last).Seconds() * l.rate >= l.burst {
+            delete(l.buckets, source)
+        }
+    }
+}
+
+// Coalesces repeated NOTIFYs for a zone from the same remote within a time window.
+type debouncer struct {
+    window time.Duration
+
+    mu sync.Mutex
+    seen map[string]debounceEntry
+    lastPrune time.Time
+}
+
+// When a zone was last notified by which remote.
+type debounceEntry struct {
+    remote string
+    at time.Time
+}
+
+// Create a debouncer with the given window. A window of 0 or less disables debouncing.
+func newDebouncer(window time.Duration) *debouncer {
+    return &debouncer{window: window, seen: make(map[string]debounceEntry)}
+}
+
+// Check whether or not a NOTIFY for zone from remote received at now has to be processed. Returns false if the
+// same remote notified the zone within the window; otherwise the NOTIFY is remembered and true returned.
+func (d *debouncer) begin(zone, remote string, now time.Time) bool {
+    if d.window <= 0 {
+        return true
+    }
+
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    d.prune(now)
+
+    e, ok := d.seen[zone]
+    if ok && e.remote == remote && now.Sub(e.at) < d.window {
+        return false
+    }
+    d.seen[zone] = debounceEntry{remote: remote, at: now}
+    return true
+}
+
+// Forget the last NOTIFY for zone, e.g. because processing it failed and a repeated NOTIFY must not be coalesced.
+func (d *debouncer) forget(zone string) {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    delete(d.seen, zone)
+}
+
+// Forget NOTIFYs outside the window. Runs at most once per window.
+func (d *debouncer) prune(now time.Time) {
+    if now.Sub(d.lastPrune) < d.window {
+        return
+    }
+    d.lastPrune = now
+
+    for zone, e := range d.seen {
+        if now.Sub(e.at) >= d.window {
+            delete(d.seen, zone)
+        }
+    }
+}
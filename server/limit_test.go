@@ -0,0 +1,72 @@
+package server
+
+import (
+    "testing"
+    "time"
+)
+
+func TestRateLimiter(t *testing.T) {
+    l := newRateLimiter(2, 3)
+    now := time.Now()
+
+    for i := 0; i < 3; i++ {
+        if !l.allow("192.0.2.1", now) {
+            t.Fatalf("Packet %d within burst was limited", i)
+        }
+    }
+    if l.allow("192.0.2.1", now) {
+        t.Fatal("Packet exceeding burst was allowed")
+    }
+    if !l.allow("192.0.2.2", now) {
+        t.Fatal("Packet from another source was limited")
+    }
+    if !l.allow("192.0.2.1", now.Add(500 * time.Millisecond)) {
+        t.Fatal("Packet after refill was limited")
+    }
+    if l.allow("192.0.2.1", now.Add(500 * time.Millisecond)) {
+        t.Fatal("Refill exceeded rate")
+    }
+
+    l.allow("192.0.2.1", now.Add(2 * time.Minute))
+    if len(l.buckets) != 1 {
+        t.Fatalf("Full buckets were not pruned: %d left", len(l.buckets))
+    }
+
+    unlimited := newRateLimiter(0, 0)
+    for i := 0; i < 100; i++ {
+        if !unlimited.allow("192.0.2.1", now) {
+            t.Fatal("Disabled rate limiter limited a packet")
+        }
+    }
+}
+
+func TestDebouncer(t *testing.T) {
+    d := newDebouncer(time.Second)
+    now := time.Now()
+
+    if !d.begin("domain.tld", "192.0.2.1", now) {
+        t.Fatal("First notify was coalesced")
+    }
+    if d.begin("domain.tld", "192.0.2.1", now.Add(500 * time.Millisecond)) {
+        t.Fatal("Repeated notify within window was not coalesced")
+    }
+    if !d.begin("other.tld", "192.0.2.1", now) {
+        t.Fatal("Notify for another zone was coalesced")
+    }
+    if !d.begin("domain.tld", "192.0.2.2", now.Add(600 * time.Millisecond)) {
+        t.Fatal("Notify from another remote was coalesced")
+    }
+    if !d.begin("domain.tld", "192.0.2.2", now.Add(2 * time.Second)) {
+        t.Fatal("Notify after window was coalesced")
+    }
+
+    d.forget("domain.tld")
+    if !d.begin("domain.tld", "192.0.2.2", now.Add(2 * time.Second)) {
+        t.Fatal("Forgotten notify was coalesced")
+    }
+
+    disabled := newDebouncer(0)
+    if !disabled.begin("domain.tld", "192.0.2.1", now) || !disabled.begin("domain.tld", "192.0.2.1", now) {
+        t.Fatal("Disabled debouncer coalesced a notify")
+    }
+}
@@ -0,0 +1,89 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package server
+
+import (
+    "fmt"
+    "net"
+    "time"
+
+    "github.com/mandrakey/dnsync/config"
+    "github.com/mandrakey/dnsync/handler"
+    "github.com/mandrakey/dnsync/state"
+)
+
+// Check whether or not the zone of req is known, either from the zone state or because a handler manages it
+// already, e.g. after an import.
+func (s *Server) known(req *handler.Request) bool {
+    if req.State != nil {
+        return true
+    }
+
+    for _, h := range s.handlers {
+        store, ok := h.(handler.ZoneStore); if !ok {
+            continue
+        }
+        zones, err := store.Zones(); if err != nil {
+            s.log.Error(config.NewEvent(fmt.Sprintf("Failed to read zones of %s: %s", h.Name(), err), req.Fields()))
+            continue
+        }
+        for _, zone := range zones {
+            if zone.Name == req.Zone {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// Queue req for approval instead of passing it to the handlers.
+func (s *Server) queuePending(req *handler.Request) {
+    p, err := s.state.AddPending(req.Zone, req.Remote.IP.String(), req.Serial, time.Now().UTC(), s.pendingTTL,
+        s.cfg.PendingMax)
+    if err == state.ErrQueueFull {
+        s.log.Warning(config.NewEvent("Approval queue is full, dropping NOTIFY for unknown zone", req.Fields()))
+        return
+    }
+    if err != nil {
+        s.log.Error(config.NewEvent(fmt.Sprintf("Failed to queue zone for approval: %s", err), req.Fields()))
+        return
+    }
+    s.metrics.NotifiesPending.Inc()
+    s.log.Info(config.NewEvent("Unknown zone waits for approval", req.Fields().With(config.Fields{
+        "expires": p.Expires.Format(time.RFC3339),
+    })))
+}
+
+// Approve the pending zone: its latest NOTIFY is passed to all handlers as if it was received just now. The zone
+// leaves the queue once all handlers succeeded; otherwise it stays pending and an error is returned.
+func (s *Server) Approve(zone string) error {
+    p, err := s.state.GetPending(zone, time.Now().UTC()); if err != nil {
+        return err
+    }
+    if p == nil {
+        return fmt.Errorf("No pending zone: %s", zone)
+    }
+
+    raddr := &net.UDPAddr{IP: net.ParseIP(p.Remote)}
+    if raddr.IP == nil {
+        return fmt.Errorf("Pending zone %s has an invalid remote: %s", zone, p.Remote)
+    }
+    req := handler.NewZoneRequest(p.Zone, p.Serial, raddr)
+    s.prepare(req)
+    s.log.Info(config.NewEvent("Zone approved", req.Fields()))
+
+    ok, refused := s.runHandlers(req, s.handlers)
+    if refused {
+        return fmt.Errorf("Zone %s was refused by a handler, see log for details", zone)
+    }
+    if !ok {
+        return fmt.Errorf("Failed to add zone %s, see log for details", zone)
+    }
+    s.recordState(req)
+    s.hooks.Wait()
+    return s.state.DeletePending(zone)
+}
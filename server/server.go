@@ -0,0 +1,442 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package server
+
+import (
+    "fmt"
+    "net"
+    "sync"
+    "time"
+    "strings"
+    "net/http"
+
+    "github.com/miekg/dns"
+    "github.com/op/go-logging"
+
+    "github.com/mandrakey/dnsync/api"
+    "github.com/mandrakey/dnsync/bind"
+    "github.com/mandrakey/dnsync/config"
+    "github.com/mandrakey/dnsync/handler"
+    "github.com/mandrakey/dnsync/metrics"
+    "github.com/mandrakey/dnsync/state"
+    "github.com/mandrakey/dnsync/webhook"
+)
+
+// A dnsync server listening for DNS NOTIFY packets and passing them on to its handlers.
+type Server struct {
+    cfg *config.AppConfig
+    handlers []handler.Handler
+    // Handlers run for every NOTIFY, see handler.Passthrough
+    passthrough []handler.Handler
+    state state.Store
+    log *logging.Logger
+    metrics *metrics.Metrics
+    hooks *webhook.Dispatcher
+    debounce *debouncer
+    // How long NOTIFYs for unknown zones wait for approval
+    pendingTTL time.Duration
+}
+
+// A packet waiting for a worker.
+type packet struct {
+    data []byte
+    raddr *net.UDPAddr
+}
+
+// Create a new Server using the configuration cfg, which will pass valid NOTIFY packets to all given handlers,
+// record them in store, report zone changes to hooks, which may be nil, and log to log.
+func New(cfg *config.AppConfig, handlers []handler.Handler, store state.Store, hooks *webhook.Dispatcher,
+        log *logging.Logger) *Server {
+    s := &Server{cfg: cfg, handlers: handlers, state: store, hooks: hooks, log: log, metrics: metrics.New()}
+
+    for _, h := range handlers {
+        if p, ok := h.(handler.Passthrough); ok && p.Passthrough() {
+            s.passthrough = append(s.passthrough, h)
+        }
+        if store, ok := h.(handler.ZoneStore); ok {
+            err := s.metrics.RegisterZoneCount(h.Name(), func() (int, error) {
+                zones, err := store.Zones()
+                return len(zones), err
+            })
+            if err != nil {
+                log.Warningf("Failed to register zone count metric for %s: %s", h.Name(), err)
+            }
+        }
+    }
+    return s
+}
+
+// Get the metrics collected by this Server.
+func (s *Server) Metrics() *metrics.Metrics {
+    return s.metrics
+}
+
+// Open a UDP socket on the configured host and port and serve on it until stop is closed. If a metrics address is
+// configured, metrics are served via HTTP on /metrics as well, and the same goes for the management API.
+func (s *Server) ListenAndServe(stop <-chan struct{}) error {
+    if s.cfg.MetricsAddress != "" {
+        mux := http.NewServeMux()
+        mux.Handle("/metrics", s.metrics.Handler())
+        defer s.serveHTTP("metrics", s.cfg.MetricsAddress, mux).Close()
+    }
+    if s.cfg.ApiAddress != "" {
+        if s.cfg.ApiToken == "" {
+            return fmt.Errorf("An api-token is required to enable the management API")
+        }
+        defer s.serveHTTP("management API", s.cfg.ApiAddress, api.New(s.handlers, s.state, s.hooks, s.cfg.ApiToken,
+            s.log)).Close()
+    }
+    if s.cfg.ReconcileInterval != "" {
+        interval, err := time.ParseDuration(s.cfg.ReconcileInterval); if err != nil {
+            return fmt.Errorf("Invalid reconcile-interval: %s", err)
+        }
+        go s.reconcileEvery(interval, stop)
+    }
+
+    addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", s.cfg.Host, s.cfg.Port)); if err != nil {
+        return err
+    }
+    conn, err := net.ListenUDP("udp", addr); if err != nil {
+        return err
+    }
+    defer conn.Close()
+
+    s.log.Infof("Listening on %s", conn.LocalAddr().String())
+    return s.Serve(conn, stop)
+}
+
+// Read packets from conn and handle them until stop is closed. Packets are handled by a fixed number of workers;
+// packets exceeding the rate limit of their source or arriving while the queue is full are dropped.
+func (s *Server) Serve(conn *net.UDPConn, stop <-chan struct{}) error {
+    window := time.Duration(0)
+    if s.cfg.Debounce != "" {
+        var err error
+        window, err = time.ParseDuration(s.cfg.Debounce); if err != nil {
+            return fmt.Errorf("Invalid debounce: %s", err)
+        }
+    }
+    s.debounce = newDebouncer(window)
+
+    if s.cfg.Pending {
+        if s.cfg.StateFile == "" {
+            return fmt.Errorf("A state-file is required to queue zones for approval")
+        }
+        var err error
+        s.pendingTTL, err = time.ParseDuration(s.cfg.PendingTTL); if err != nil {
+            return fmt.Errorf("Invalid pending-ttl: %s", err)
+        }
+    }
+    limiter := newRateLimiter(s.cfg.RateLimit, s.cfg.RateBurst)
+
+    queueSize, workers := s.cfg.QueueSize, s.cfg.Workers
+    if queueSize < 0 {
+        queueSize = 0
+    }
+    if workers < 1 {
+        workers = 1
+    }
+
+    // Deliver outstanding webhooks once all workers are done
+    defer s.hooks.Wait()
+
+    queue := make(chan packet, queueSize)
+    wg := sync.WaitGroup{}
+    for i := 0; i < workers; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for p := range queue {
+                s.handlePacket(conn, p.data, p.raddr)
+            }
+        }()
+    }
+    defer wg.Wait()
+    defer close(queue)
+
+    buf := make([]byte, 4096)
+    for {
+        conn.SetReadDeadline(time.Now().Add(time.Second))
+        n, raddr, _ := conn.ReadFromUDP(buf)
+
+        if n > 0 {
+            s.metrics.NotifiesReceived.Inc()
+            s.log.Debugf("Read %d bytes from %s", n, raddr.String())
+            s.enqueue(queue, limiter, buf[:n], raddr)
+        }
+
+        // Check if we were asked to stop in the meantime
+        select {
+        case <-stop:
+            s.log.Infof("Shutting down.")
+            return nil
+
+        default:
+        }
+    }
+}
+
+// Pass a copy of data to the workers, unless its source exceeds its rate limit or the queue is full.
+func (s *Server) enqueue(queue chan<- packet, limiter *rateLimiter, data []byte, raddr *net.UDPAddr) {
+    if !limiter.allow(raddr.IP.String(), time.Now()) {
+        s.log.Debugf("Drop packet from %s: rate limit exceeded", raddr.IP)
+        s.metrics.PacketsDropped.WithLabelValues(metrics.REASON_RATE_LIMITED).Inc()
+        return
+    }
+
+    p := packet{data: make([]byte, len(data)), raddr: raddr}
+    copy(p.data, data)
+    select {
+    case queue <- p:
+    default:
+        s.log.Warningf("Drop packet from %s: queue is full", raddr.IP)
+        s.metrics.PacketsDropped.WithLabelValues(metrics.REASON_QUEUE_FULL).Inc()
+    }
+}
+
+// Method to handle incoming DNS packets. Only packets with opcode NOTIFY and type SOA will be handled, everything
+// else will be discarded. If a valid packet is found, it is sent to every registered handler to work with it, unless
+// the zone is known and its masters did not change or the same remote notified it within the debounce window; then
+// only passthrough handlers like the relay get it. In pending mode, NOTIFYs for unknown zones are queued for
+// approval instead. After all handlers have finished processing, a DNS reply packet will be sent to the client.
+func (s *Server) handlePacket(conn *net.UDPConn, data []byte, raddr *net.UDPAddr) {
+    if !s.validRemote(raddr.IP) {
+        s.log.Infof("Discard packet from invalid remote address %s", raddr.IP)
+        s.metrics.NotifiesRejected.WithLabelValues(metrics.REASON_INVALID_REMOTE).Inc()
+        return
+    }
+
+    msg := dns.Msg{}
+    err := msg.Unpack(data); if err != nil {
+        s.log.Errorf("Failed to unpack packet: %s", err)
+        s.metrics.NotifiesRejected.WithLabelValues(metrics.REASON_MALFORMED).Inc()
+        return
+    }
+
+    if msg.MsgHdr.Opcode != dns.OpcodeNotify || len(msg.Answer) == 0 || msg.Answer[0].Header().Rrtype != dns.TypeSOA {
+        // invalid request, not a notify
+        s.log.Info("Skip invalid notify")
+        s.metrics.NotifiesRejected.WithLabelValues(metrics.REASON_NOT_NOTIFY).Inc()
+        return
+    }
+
+    req := handler.NewRequest(&msg, raddr)
+    req.Zone, err = bind.NormalizeZoneName(req.Zone); if err != nil {
+        s.log.Warningf("Discard notify from %s: %s", raddr.IP, err)
+        s.metrics.NotifiesRejected.WithLabelValues(metrics.REASON_INVALID_ZONE).Inc()
+        return
+    }
+    s.prepare(req)
+    s.log.Info(config.NewEvent("Received notify", req.Fields()))
+
+    if !s.debounce.begin(req.Zone, raddr.IP.String(), time.Now()) {
+        s.metrics.NotifiesCoalesced.Inc()
+        s.log.Info(config.NewEvent("Repeated notify, skipping handlers", req.Fields()))
+        s.runHandlers(req, s.passthrough)
+        s.reply(conn, &msg, req, dns.RcodeSuccess)
+        return
+    }
+
+    req.State, err = s.state.Get(req.Zone); if err != nil {
+        s.log.Error(config.NewEvent(fmt.Sprintf("Failed to read zone state: %s", err), req.Fields()))
+    }
+
+    if s.cfg.Pending && !s.known(req) {
+        s.queuePending(req)
+    } else if s.unchanged(req) {
+        s.metrics.NotifiesSkipped.Inc()
+        s.log.Info(config.NewEvent("Zone unchanged, skipping handlers", req.Fields()))
+        s.runHandlers(req, s.passthrough)
+        s.recordState(req)
+    } else if ok, refused := s.runHandlers(req, s.handlers); ok {
+        s.recordState(req)
+    } else {
+        // Let a repeated NOTIFY retry the failed handlers
+        s.debounce.forget(req.Zone)
+        if refused {
+            s.reply(conn, &msg, req, dns.RcodeRefused)
+            return
+        }
+    }
+    s.reply(conn, &msg, req, dns.RcodeSuccess)
+}
+
+// Fill in what the configuration says about the remote of req, and the state store.
+func (s *Server) prepare(req *handler.Request) {
+    req.Masters = s.cfg.MastersOf(req.Remote.IP.String())
+    req.Group = s.cfg.RemoteGroupOf(req.Remote.IP.String())
+    req.Store = s.state
+}
+
+// Send the reply to the NOTIFY msg with the given rcode.
+func (s *Server) reply(conn *net.UDPConn, msg *dns.Msg, req *handler.Request, rcode int) {
+    res := dns.Msg{}
+    res.SetRcode(msg, rcode)
+    s.log.Debug(config.NewEvent("Sending reply", req.Fields()))
+
+    out, err := res.Pack(); if err != nil {
+        s.log.Errorf("Failed to pack reply: %s", err)
+        return
+    }
+    _, err = conn.WriteToUDP(out, req.Remote); if err != nil {
+        s.log.Errorf("Failed to send reply to %s: %s", req.Remote.String(), err)
+    }
+}
+
+// Check whether or not req is about a known zone there is nothing for the handlers to do for. This is the case if
+// the masters the handlers derive from req, starting from the recorded ones, equal those recorded for the zone. This
+// takes the master map, remote groups and master policies into account; with the merge policy, NOTIFYs from masters
+// the zone has already are skipped. A NOTIFY carrying a serial older than the recorded one arrived late and
+// must not change the masters back, so it is skipped as well.
+func (s *Server) unchanged(req *handler.Request) bool {
+    if req.State == nil {
+        return false
+    }
+    if state.SerialAfter(req.State.Serial, req.Serial) {
+        s.log.Debug(config.NewEvent(fmt.Sprintf("Serial is older than last seen serial %d", req.State.Serial),
+            req.Fields()))
+        return true
+    }
+    return bind.SameMasters(req.State.Masters, s.masters(req))
+}
+
+// Pass req to handlers. Returns whether or not all of them succeeded, and whether or not one of them refused the
+// zone.
+func (s *Server) runHandlers(req *handler.Request, handlers []handler.Handler) (bool, bool) {
+    ok, refused := true, false
+    for _, h := range handlers {
+        fields := req.Fields().With(config.Fields{"handler": h.Name()})
+        if s.cfg.Verbose {
+            s.log.Debug(config.NewEvent("Processing message", fields))
+        }
+
+        start := time.Now()
+        action, err := h.HandleMessage(req)
+        duration := time.Since(start)
+        if err != nil {
+            action = handler.ACTION_ERROR
+        }
+        fields["action"] = action
+        fields["duration_ms"] = duration.Nanoseconds() / int64(time.Millisecond)
+        s.metrics.HandlerDuration.WithLabelValues(h.Name()).Observe(duration.Seconds())
+        s.metrics.NotifiesHandled.WithLabelValues(h.Name(), string(action)).Inc()
+
+        if err != nil {
+            fields["error"] = err.Error()
+            s.log.Error(config.NewEvent("Handler failed", fields))
+            ok = false
+        } else if action == handler.ACTION_REFUSED {
+            s.log.Warning(config.NewEvent("Handler refused zone", fields))
+            ok, refused = false, true
+        } else {
+            s.log.Info(config.NewEvent("Handled notify", fields))
+            s.sendEvent(h, req, action)
+        }
+    }
+    return ok, refused
+}
+
+// Report a change of the zone of req by the handler h to the webhooks. The masters are taken from the handler's
+// zone set, since its master policy decides about them.
+func (s *Server) sendEvent(h handler.Handler, req *handler.Request, action handler.Action) {
+    if action != handler.ACTION_ADDED && action != handler.ACTION_UPDATED {
+        return
+    }
+
+    masters := req.Masters
+    if store, ok := h.(handler.ZoneStore); ok {
+        zones, err := store.Zones(); if err != nil {
+            s.log.Error(config.NewEvent(fmt.Sprintf("Failed to read zones of %s: %s", h.Name(), err), req.Fields()))
+        }
+        for _, zone := range zones {
+            if zone.Name == req.Zone {
+                masters = zone.Masters
+            }
+        }
+    }
+    s.hooks.Send(webhook.Event{Zone: req.Zone, Masters: masters, Handler: h.Name(), Action: string(action),
+        Timestamp: time.Now().UTC(), Remote: req.Remote.IP.String()})
+}
+
+// Determine the masters the handlers give the zone of req, starting from those recorded for it.
+func (s *Server) masters(req *handler.Request) []bind.Master {
+    var current []bind.Master
+    if req.State != nil {
+        current = req.State.Masters
+    }
+    return handler.Masters(s.handlers, req, current)
+}
+
+// Record req in the zone state. This is only done once all handlers know about the zone, so a NOTIFY that failed
+// in some handler is not skipped when it is repeated.
+func (s *Server) recordState(req *handler.Request) {
+    _, err := s.state.Notify(req.Zone, req.Remote.IP.String(), req.Serial, s.masters(req), time.Now().UTC())
+    if err != nil {
+        s.log.Error(config.NewEvent(fmt.Sprintf("Failed to record zone state: %s", err), req.Fields()))
+    }
+}
+
+// Reconcile the zone sets of all handlers every interval until stop is closed.
+func (s *Server) reconcileEvery(interval time.Duration, stop <-chan struct{}) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-stop:
+            return
+        case <-ticker.C:
+            s.reconcile()
+        }
+    }
+}
+
+// Reconcile the zone sets of all handlers once and log any drift found.
+func (s *Server) reconcile() {
+    drifts, err := handler.Reconcile(s.cfg, s.handlers, s.cfg.ReconcileFix)
+    for _, d := range drifts {
+        fields := config.Fields{"zone": d.Zone, "source": d.Source}
+        if len(d.Missing) > 0 {
+            fields["missing"] = strings.Join(d.Missing, ",")
+        }
+        if len(d.MastersDiffer) > 0 {
+            fields["masters_differ"] = strings.Join(d.MastersDiffer, ",")
+        }
+        if len(d.Fixed) > 0 {
+            fields["fixed"] = strings.Join(d.Fixed, ",")
+        }
+        s.log.Warning(config.NewEvent("Zone differs between handlers", fields))
+        for _, name := range d.Fixed {
+            s.hooks.Send(webhook.Event{Zone: d.Zone, Masters: d.Masters, Handler: name,
+                Action: string(handler.ACTION_ADDED), Timestamp: time.Now().UTC()})
+        }
+    }
+    if err != nil {
+        s.log.Errorf("Failed to reconcile handlers: %s", err)
+    }
+}
+
+// Serve h via HTTP on address in the background. The returned http.Server must be closed by the caller.
+func (s *Server) serveHTTP(name, address string, h http.Handler) *http.Server {
+    srv := &http.Server{Addr: address, Handler: h}
+    go func() {
+        s.log.Infof("Serving %s on %s", name, address)
+        err := srv.ListenAndServe(); if err != nil && err != http.ErrServerClosed {
+            s.log.Errorf("Listener for %s failed: %s", name, err)
+        }
+    }()
+    return srv
+}
+
+// Checks whether or not a given ip address is in the list of configured remotes or in a remote group.
+func (s *Server) validRemote(ip net.IP) bool {
+    for _, r := range s.cfg.Remotes {
+        if r == ip.String() {
+            return true
+        }
+    }
+    return s.cfg.RemoteGroupOf(ip.String()) != nil
+}
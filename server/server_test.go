@@ -0,0 +1,489 @@
+package server
+
+import (
+    "os"
+    "fmt"
+    "io/ioutil"
+    "net"
+    "strings"
+    "net/http"
+    "net/http/httptest"
+    "encoding/json"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/miekg/dns"
+    "github.com/op/go-logging"
+    dto "github.com/prometheus/client_model/go"
+
+    "github.com/mandrakey/dnsync/bind"
+    "github.com/mandrakey/dnsync/config"
+    "github.com/mandrakey/dnsync/handler"
+    "github.com/mandrakey/dnsync/state"
+    "github.com/mandrakey/dnsync/webhook"
+)
+
+// Create a logger discarding all output.
+func testLogger() *logging.Logger {
+    log := logging.MustGetLogger("test")
+    log.SetBackend(logging.AddModuleLevel(logging.NewLogBackend(ioutil.Discard, "", 0)))
+    return log
+}
+
+// Start a Server with a single bind handler and a state file in a temporary directory. Debouncing is disabled, so
+// repeated NOTIFYs reach the state checks. Returns the server, its address and the bind configuration file.
+func startTestServer(t *testing.T, remotes []string) (*Server, string, string) {
+    cfg := config.NewAppConfig()
+    cfg.Remotes = remotes
+    cfg.Debounce = ""
+    return startTestServerWith(t, cfg)
+}
+
+// Start a Server using cfg with a bind handler, followed by the handlers already in cfg, and a state file in a
+// temporary directory. The bind handler's configuration can be changed with opts.
+func startTestServerWith(t *testing.T, cfg *config.AppConfig, opts ...func(*config.Handler)) (*Server, string, string) {
+    dir := t.TempDir()
+    cfg.Handlers = append([]config.Handler{
+        {
+            Name: "bind",
+            Type: handler.HANDLER_BIND,
+            BindHandler: config.BindHandler{
+                BindConfigFile: filepath.Join(dir, "dnsync.conf"),
+                BindZonefilesPath: dir,
+            },
+        },
+    }, cfg.Handlers...)
+    for _, opt := range opts {
+        opt(&cfg.Handlers[0])
+    }
+
+    log := testLogger()
+    handlers, err := handler.NewAll(cfg, log); if err != nil {
+        t.Fatalf("Failed to create handlers: %s", err)
+    }
+
+    conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")}); if err != nil {
+        t.Fatalf("Failed to listen: %s", err)
+    }
+
+    cfg.StateFile = filepath.Join(dir, "state.db")
+    store, err := state.Open(cfg.StateFile); if err != nil {
+        t.Fatalf("Failed to open state: %s", err)
+    }
+
+    hooks, err := webhook.New(cfg.Webhooks, log); if err != nil {
+        t.Fatalf("Failed to create webhooks: %s", err)
+    }
+
+    srv := New(cfg, handlers, store, hooks, log)
+    stop := make(chan struct{})
+    done := make(chan struct{})
+    go func() {
+        srv.Serve(conn, stop)
+        close(done)
+    }()
+    t.Cleanup(func() {
+        close(stop)
+        <-done
+        conn.Close()
+    })
+
+    return srv, conn.LocalAddr().String(), cfg.Handlers[0].BindConfigFile
+}
+
+// Send a NOTIFY for zone to addr and return the reply.
+func sendNotify(addr, zone string) (*dns.Msg, error) {
+    return sendNotifySerial(addr, zone, 1)
+}
+
+// Send a NOTIFY for zone carrying serial to addr and wait for the reply.
+func sendNotifySerial(addr, zone string, serial uint32) (*dns.Msg, error) {
+    return sendNotifyFrom(addr, zone, serial, "127.0.0.1")
+}
+
+// Send a NOTIFY for zone carrying serial from the local address from to addr and wait for the reply.
+func sendNotifyFrom(addr, zone string, serial uint32, from string) (*dns.Msg, error) {
+    msg := new(dns.Msg)
+    msg.SetNotify(dns.Fqdn(zone))
+    soa, _ := dns.NewRR(fmt.Sprintf("%s 3600 IN SOA ns1.example.com. admin.example.com. %d 3600 600 86400 3600",
+        dns.Fqdn(zone), serial))
+    msg.Answer = []dns.RR{soa}
+
+    c := dns.Client{Timeout: time.Second,
+        Dialer: &net.Dialer{Timeout: time.Second, LocalAddr: &net.UDPAddr{IP: net.ParseIP(from)}}}
+    res, _, err := c.Exchange(msg, addr)
+    return res, err
+}
+
+func TestServerHandlesNotify(t *testing.T) {
+    t.Parallel()
+    _, addr, file := startTestServer(t, []string{"127.0.0.1"})
+
+    res, err := sendNotify(addr, "domain.tld"); if err != nil {
+        t.Fatalf("Failed to send notify: %s", err)
+    }
+    if res.Rcode != dns.RcodeSuccess {
+        t.Fatalf("Reply rcode is %s, expected NOERROR", dns.RcodeToString[res.Rcode])
+    }
+
+    bc := bind.NewBindConfig()
+    err = bc.Load(file); if err != nil {
+        t.Fatalf("Failed to load bind config: %s", err)
+    }
+    if bc.GetZone("domain.tld") == nil {
+        t.Fatalf("Notified zone was not added:\n%s", bc.String())
+    }
+}
+
+func TestServerDiscardsInvalidRemote(t *testing.T) {
+    t.Parallel()
+    srv, addr, file := startTestServer(t, []string{"1.2.3.4"})
+
+    _, err := sendNotify(addr, "domain.tld"); if err == nil {
+        t.Fatalf("Notify from invalid remote got a reply")
+    }
+
+    rec := httptest.NewRecorder()
+    srv.Metrics().Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+    if !strings.Contains(rec.Body.String(), "dnsync_notifies_rejected_total{reason=\"invalid_remote\"} 1") {
+        t.Fatalf("Rejected notify not counted:\n%s", rec.Body.String())
+    }
+
+    bc := bind.NewBindConfig()
+    if bc.Load(file) == nil {
+        t.Fatalf("Notify from invalid remote created a bind config")
+    }
+}
+
+func TestServerDiscardsInvalidZone(t *testing.T) {
+    t.Parallel()
+    srv, addr, file := startTestServer(t, []string{"127.0.0.1"})
+
+    _, err := sendNotify(addr, "evil/zone.tld"); if err == nil {
+        t.Fatalf("Notify for invalid zone got a reply")
+    }
+
+    rec := httptest.NewRecorder()
+    srv.Metrics().Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+    if !strings.Contains(rec.Body.String(), "dnsync_notifies_rejected_total{reason=\"invalid_zone\"} 1") {
+        t.Fatalf("Rejected notify not counted:\n%s", rec.Body.String())
+    }
+    if _, err := os.Stat(file); !os.IsNotExist(err) {
+        t.Fatalf("Notify for invalid zone created a bind config")
+    }
+}
+
+func TestServerMetrics(t *testing.T) {
+    t.Parallel()
+    srv, addr, _ := startTestServer(t, []string{"127.0.0.1"})
+
+    for i := 0; i < 2; i++ {
+        _, err := sendNotify(addr, "domain.tld"); if err != nil {
+            t.Fatalf("Failed to send notify: %s", err)
+        }
+    }
+
+    rec := httptest.NewRecorder()
+    srv.Metrics().Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+    out := rec.Body.String()
+
+    for _, expect := range []string{
+        "dnsync_notifies_received_total 2",
+        "dnsync_notifies_skipped_total 1",
+        "dnsync_notifies_handled_total{handler=\"bind\",result=\"added\"} 1",
+        "dnsync_handler_duration_seconds_count{handler=\"bind\"} 1",
+        "dnsync_zones{handler=\"bind\"} 1",
+    } {
+        if !strings.Contains(out, expect) {
+            t.Fatalf("Metrics do not contain %q:\n%s", expect, out)
+        }
+    }
+}
+
+func TestServerRecordsState(t *testing.T) {
+    t.Parallel()
+    srv, addr, _ := startTestServer(t, []string{"127.0.0.1"})
+
+    _, err := sendNotify(addr, "domain.tld"); if err != nil {
+        t.Fatalf("Failed to send notify: %s", err)
+    }
+
+    rec, err := srv.state.Get("domain.tld"); if err != nil {
+        t.Fatalf("Failed to read state: %s", err)
+    }
+    if rec == nil || rec.Origin != "127.0.0.1" || rec.Serial != 1 || rec.FirstSeen.IsZero() {
+        t.Fatalf("Notify not recorded correctly: %+v", rec)
+    }
+}
+
+func TestServerSkipsKnownZones(t *testing.T) {
+    t.Parallel()
+    srv, addr, file := startTestServer(t, []string{"127.0.0.1"})
+
+    _, err := sendNotify(addr, "domain.tld"); if err != nil {
+        t.Fatalf("Failed to send notify: %s", err)
+    }
+
+    // A zone removed behind dnsync's back stays removed as long as its master does not change
+    os.Remove(file)
+    res, err := sendNotify(addr, "domain.tld"); if err != nil {
+        t.Fatalf("Failed to send notify: %s", err)
+    }
+    if res.Rcode != dns.RcodeSuccess {
+        t.Fatalf("Reply rcode is %s, expected NOERROR", dns.RcodeToString[res.Rcode])
+    }
+    if _, err := os.Stat(file); !os.IsNotExist(err) {
+        t.Fatalf("Known zone was passed to the handlers")
+    }
+
+    // A changed master is passed on
+    srv.state.Notify("domain.tld", "192.0.2.1", 1, bind.MastersFrom("192.0.2.1"), time.Now())
+    _, err = sendNotify(addr, "domain.tld"); if err != nil {
+        t.Fatalf("Failed to send notify: %s", err)
+    }
+    bc := bind.NewBindConfig()
+    err = bc.Load(file); if err != nil || bc.GetZone("domain.tld") == nil {
+        t.Fatalf("Zone with changed master was not passed to the handlers: %v", err)
+    }
+
+    // A late NOTIFY with an older serial does not change the masters back
+    srv.state.Notify("domain.tld", "192.0.2.1", 5, bind.MastersFrom("192.0.2.1"), time.Now())
+    os.Remove(file)
+    _, err = sendNotifySerial(addr, "domain.tld", 3); if err != nil {
+        t.Fatalf("Failed to send notify: %s", err)
+    }
+    if _, err := os.Stat(file); !os.IsNotExist(err) {
+        t.Fatalf("NOTIFY with older serial was passed to the handlers")
+    }
+    _, err = sendNotifySerial(addr, "domain.tld", 6); if err != nil {
+        t.Fatalf("Failed to send notify: %s", err)
+    }
+    if _, err := os.Stat(file); err != nil {
+        t.Fatalf("NOTIFY with newer serial and changed master was not passed to the handlers")
+    }
+}
+
+func TestServerSkipsKnownMastersWithMerge(t *testing.T) {
+    t.Parallel()
+    cfg := config.NewAppConfig()
+    cfg.Remotes = []string{"127.0.0.1", "127.0.0.2"}
+    cfg.Debounce = "0s"
+    srv, addr, file := startTestServerWith(t, cfg, func(h *config.Handler) {
+        h.MasterPolicy = handler.MASTER_POLICY_MERGE
+    })
+
+    // Both primaries notify in turn
+    remotes := []string{"127.0.0.1", "127.0.0.2"}
+    for serial := uint32(1); serial <= 6; serial++ {
+        _, err := sendNotifyFrom(addr, "domain.tld", serial, remotes[serial % 2]); if err != nil {
+            t.Fatalf("Failed to send notify: %s", err)
+        }
+    }
+
+    bc := bind.NewBindConfig()
+    err := bc.Load(file); if err != nil || bc.GetZone("domain.tld") == nil {
+        t.Fatalf("Zone was not added: %v", err)
+    }
+    if masters := bc.GetZone("domain.tld").Masters; len(masters) != 2 {
+        t.Fatalf("Masters not merged: %v", masters)
+    }
+    skipped := &dto.Metric{}
+    srv.metrics.NotifiesSkipped.Write(skipped)
+    if skipped.GetCounter().GetValue() != 4 {
+        t.Fatalf("Expected 4 NOTIFYs from known masters to be skipped, got %v", skipped.GetCounter().GetValue())
+    }
+}
+
+func TestServerCoalescesRepeatedNotifies(t *testing.T) {
+    t.Parallel()
+    cfg := config.NewAppConfig()
+    cfg.Remotes = []string{"127.0.0.1"}
+    cfg.Debounce = "1m"
+    srv, addr, file := startTestServerWith(t, cfg)
+
+    _, err := sendNotify(addr, "domain.tld"); if err != nil {
+        t.Fatalf("Failed to send notify: %s", err)
+    }
+    os.Remove(file)
+    srv.state.Delete("domain.tld")
+
+    res, err := sendNotify(addr, "domain.tld"); if err != nil {
+        t.Fatalf("Failed to send notify: %s", err)
+    }
+    if res.Rcode != dns.RcodeSuccess {
+        t.Fatalf("Reply rcode is %s, expected NOERROR", dns.RcodeToString[res.Rcode])
+    }
+    if _, err := os.Stat(file); !os.IsNotExist(err) {
+        t.Fatalf("Repeated notify was passed to the handlers")
+    }
+
+    rec := httptest.NewRecorder()
+    srv.Metrics().Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+    if !strings.Contains(rec.Body.String(), "dnsync_notifies_coalesced_total 1") {
+        t.Fatalf("Coalesced notify not counted:\n%s", rec.Body.String())
+    }
+}
+
+func TestServerDropsRateLimitedPackets(t *testing.T) {
+    t.Parallel()
+    cfg := config.NewAppConfig()
+    cfg.Remotes = []string{"127.0.0.1"}
+    cfg.RateLimit = 0.001
+    cfg.RateBurst = 1
+    srv, addr, _ := startTestServerWith(t, cfg)
+
+    _, err := sendNotify(addr, "domain.tld"); if err != nil {
+        t.Fatalf("Failed to send notify: %s", err)
+    }
+    _, err = sendNotify(addr, "other.tld"); if err == nil {
+        t.Fatalf("Notify exceeding the rate limit got a reply")
+    }
+
+    rec := httptest.NewRecorder()
+    srv.Metrics().Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+    if !strings.Contains(rec.Body.String(), "dnsync_packets_dropped_total{reason=\"rate_limited\"} 1") {
+        t.Fatalf("Dropped packet not counted:\n%s", rec.Body.String())
+    }
+}
+
+func TestServerRefusesZonesOverQuota(t *testing.T) {
+    t.Parallel()
+    cfg := config.NewAppConfig()
+    cfg.Remotes = []string{"127.0.0.1"}
+    cfg.Debounce = ""
+    srv, addr, _ := startTestServerWith(t, cfg, func(h *config.Handler) {
+        h.MaxZones = 1
+    })
+
+    _, err := sendNotify(addr, "domain.tld"); if err != nil {
+        t.Fatalf("Failed to send notify: %s", err)
+    }
+    res, err := sendNotify(addr, "other.tld"); if err != nil {
+        t.Fatalf("Failed to send notify: %s", err)
+    }
+    if res.Rcode != dns.RcodeRefused {
+        t.Fatalf("Reply rcode is %s, expected REFUSED", dns.RcodeToString[res.Rcode])
+    }
+    if rec, _ := srv.state.Get("other.tld"); rec != nil {
+        t.Fatalf("State of refused zone was recorded")
+    }
+}
+
+func TestServerQueuesUnknownZones(t *testing.T) {
+    t.Parallel()
+    cfg := config.NewAppConfig()
+    cfg.Remotes = []string{"127.0.0.1"}
+    cfg.Pending = true
+    srv, addr, file := startTestServerWith(t, cfg)
+
+    res, err := sendNotify(addr, "domain.tld"); if err != nil {
+        t.Fatalf("Failed to send notify: %s", err)
+    }
+    if res.Rcode != dns.RcodeSuccess {
+        t.Fatalf("Reply rcode is %s, expected NOERROR", dns.RcodeToString[res.Rcode])
+    }
+    if _, err := os.Stat(file); !os.IsNotExist(err) {
+        t.Fatalf("Unknown zone was passed to the handlers")
+    }
+
+    p, err := srv.state.GetPending("domain.tld", time.Now()); if err != nil || p == nil {
+        t.Fatalf("Unknown zone not queued: %v, %v", p, err)
+    }
+    if p.Remote != "127.0.0.1" || p.Serial != 1 || p.Expires.Sub(p.FirstSeen) != 72 * time.Hour {
+        t.Fatalf("Unknown zone queued wrong: %+v", p)
+    }
+
+    err = srv.Approve("domain.tld"); if err != nil {
+        t.Fatalf("Failed to approve zone: %s", err)
+    }
+    bc := bind.NewBindConfig()
+    err = bc.Load(file); if err != nil || bc.GetZone("domain.tld") == nil {
+        t.Fatalf("Approved zone was not added: %v", err)
+    }
+    if p, _ := srv.state.GetPending("domain.tld", time.Now()); p != nil {
+        t.Fatalf("Approved zone still pending")
+    }
+    if rec, _ := srv.state.Get("domain.tld"); rec == nil {
+        t.Fatalf("State of approved zone not recorded")
+    }
+
+    if srv.Approve("other.tld") == nil {
+        t.Fatalf("Approving a zone that is not pending succeeded")
+    }
+}
+
+func TestServerSendsWebhooks(t *testing.T) {
+    t.Parallel()
+    events := make(chan webhook.Event, 10)
+    receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        e := webhook.Event{}
+        json.NewDecoder(r.Body).Decode(&e)
+        events <- e
+    }))
+    defer receiver.Close()
+
+    cfg := config.NewAppConfig()
+    cfg.Remotes = []string{"127.0.0.1"}
+    cfg.Debounce = ""
+    cfg.Webhooks = []config.Webhook{{URL: receiver.URL}}
+    srv, addr, _ := startTestServerWith(t, cfg)
+
+    _, err := sendNotify(addr, "domain.tld"); if err != nil {
+        t.Fatalf("Failed to send notify: %s", err)
+    }
+    srv.hooks.Wait()
+
+    select {
+    case e := <-events:
+        if e.Zone != "domain.tld" || e.Handler != "bind" || e.Action != "added" || e.Remote != "127.0.0.1" ||
+                len(e.Masters) != 1 || e.Masters[0].Address != "127.0.0.1" {
+            t.Fatalf("Wrong webhook event: %+v", e)
+        }
+    default:
+        t.Fatalf("No webhook sent for added zone")
+    }
+}
+
+func TestServerRelaysEveryNotify(t *testing.T) {
+    t.Parallel()
+    serials := make(chan uint32, 10)
+    pc, err := net.ListenPacket("udp", "127.0.0.1:0"); if err != nil {
+        t.Fatalf("Failed to listen: %s", err)
+    }
+    downstream := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+        if soa, ok := r.Answer[0].(*dns.SOA); ok {
+            serials <- soa.Serial
+        }
+        res := new(dns.Msg)
+        res.SetReply(r)
+        w.WriteMsg(res)
+    })}
+    go downstream.ActivateAndServe()
+    defer downstream.Shutdown()
+
+    cfg := config.NewAppConfig()
+    cfg.Remotes = []string{"127.0.0.1"}
+    cfg.Debounce = "1m"
+    cfg.Handlers = []config.Handler{{Name: "relay", Type: handler.HANDLER_RELAY,
+        RelayHandler: config.RelayHandler{RelayTargets: []string{pc.LocalAddr().String()}}}}
+    srv, addr, _ := startTestServerWith(t, cfg)
+
+    // The second NOTIFY is within the debounce window, the third one for a known zone with unchanged masters
+    for _, serial := range []uint32{1, 2, 3} {
+        if serial == 3 {
+            srv.debounce.forget("domain.tld")
+        }
+        _, err := sendNotifySerial(addr, "domain.tld", serial); if err != nil {
+            t.Fatalf("Failed to send notify: %s", err)
+        }
+        select {
+        case got := <-serials:
+            if got != serial {
+                t.Fatalf("Relayed serial %d, expected %d", got, serial)
+            }
+        case <-time.After(2 * time.Second):
+            t.Fatalf("NOTIFY with serial %d was not relayed", serial)
+        }
+    }
+}
@@ -0,0 +1,236 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package state
+
+import (
+    "fmt"
+    "time"
+    "encoding/json"
+
+    bolt "go.etcd.io/bbolt"
+
+    "github.com/mandrakey/dnsync/bind"
+)
+
+// Names of the buckets holding the zone records and the pending entries.
+var (
+    bucketZones = []byte("zones")
+    bucketPending = []byte("pending")
+)
+
+// How long to wait for another process to release the database.
+const lockTimeout = 5 * time.Second
+
+// A Store keeping all records in a bbolt database file. The database is only opened for the duration of each
+// operation, so the running daemon and CLI commands can use the same file.
+type boltStore struct {
+    path string
+}
+
+// Open the bbolt database at path, creating it if necessary.
+func Open(path string) (Store, error) {
+    s := &boltStore{path: path}
+    err := s.update(bucketZones, func(b *bolt.Bucket) error { return nil }); if err != nil {
+        return nil, err
+    }
+    return s, nil
+}
+
+// Retrieve the record of zone, or nil if the zone is unknown.
+func (s *boltStore) Get(zone string) (*Record, error) {
+    var rec *Record
+    err := s.view(bucketZones, func(b *bolt.Bucket) error {
+        var err error
+        rec, err = decode(b.Get([]byte(zone)))
+        return err
+    })
+    return rec, err
+}
+
+// Retrieve the records of all known zones, sorted by zone name.
+func (s *boltStore) List() ([]*Record, error) {
+    res := make([]*Record, 0)
+    err := s.view(bucketZones, func(b *bolt.Bucket) error {
+        return b.ForEach(func(k, v []byte) error {
+            rec, err := decode(v); if err != nil {
+                return err
+            }
+            res = append(res, rec)
+            return nil
+        })
+    })
+    return res, err
+}
+
+// Record a NOTIFY for zone.
+func (s *boltStore) Notify(zone, remote string, serial uint32, masters []bind.Master, t time.Time) (*Record,
+        error) {
+    var rec *Record
+    err := s.update(bucketZones, func(b *bolt.Bucket) error {
+        old, err := decode(b.Get([]byte(zone))); if err != nil {
+            return err
+        }
+        rec = applyNotify(old, zone, remote, serial, masters, t)
+
+        data, err := json.Marshal(rec); if err != nil {
+            return err
+        }
+        return b.Put([]byte(zone), data)
+    })
+    return rec, err
+}
+
+// Forget about zone.
+func (s *boltStore) Delete(zone string) error {
+    return s.update(bucketZones, func(b *bolt.Bucket) error {
+        return b.Delete([]byte(zone))
+    })
+}
+
+// Queue a NOTIFY for zone for approval.
+func (s *boltStore) AddPending(zone, remote string, serial uint32, t time.Time, ttl time.Duration,
+        max int) (*Pending, error) {
+    var p *Pending
+    err := s.update(bucketPending, func(b *bolt.Bucket) error {
+        list, err := purgePending(b, t); if err != nil {
+            return err
+        }
+        old, err := decodePending(b.Get([]byte(zone))); if err != nil {
+            return err
+        }
+        if old == nil && max > 0 && len(list) >= max {
+            return ErrQueueFull
+        }
+        p = applyPending(old, zone, remote, serial, t, ttl)
+
+        data, err := json.Marshal(p); if err != nil {
+            return err
+        }
+        return b.Put([]byte(zone), data)
+    })
+    return p, err
+}
+
+// Retrieve the pending entry of zone.
+func (s *boltStore) GetPending(zone string, t time.Time) (*Pending, error) {
+    var p *Pending
+    err := s.view(bucketPending, func(b *bolt.Bucket) error {
+        var err error
+        p, err = decodePending(b.Get([]byte(zone)))
+        return err
+    })
+    if p != nil && p.Expired(t) {
+        return nil, err
+    }
+    return p, err
+}
+
+// Retrieve all pending entries not expired at t.
+func (s *boltStore) ListPending(t time.Time) ([]*Pending, error) {
+    var res []*Pending
+    err := s.update(bucketPending, func(b *bolt.Bucket) error {
+        var err error
+        res, err = purgePending(b, t)
+        return err
+    })
+    return res, err
+}
+
+// Remove the entries expired at t from the pending bucket b and return the remaining ones.
+func purgePending(b *bolt.Bucket, t time.Time) ([]*Pending, error) {
+    res := make([]*Pending, 0)
+    expired := make([][]byte, 0)
+    err := b.ForEach(func(k, v []byte) error {
+        p, err := decodePending(v); if err != nil {
+            return err
+        }
+        if p.Expired(t) {
+            expired = append(expired, k)
+        } else {
+            res = append(res, p)
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    for _, k := range expired {
+        err := b.Delete(k); if err != nil {
+            return nil, err
+        }
+    }
+    return res, nil
+}
+
+// Remove the pending entry of zone.
+func (s *boltStore) DeletePending(zone string) error {
+    return s.update(bucketPending, func(b *bolt.Bucket) error {
+        return b.Delete([]byte(zone))
+    })
+}
+
+// Nothing to release, since the database is only open during operations.
+func (s *boltStore) Close() error {
+    return nil
+}
+
+// Open the database and run fn in a read-only transaction on the bucket name.
+func (s *boltStore) view(name []byte, fn func(b *bolt.Bucket) error) error {
+    db, err := bolt.Open(s.path, 0600, &bolt.Options{Timeout: lockTimeout}); if err != nil {
+        return fmt.Errorf("Failed to open state file %s: %s", s.path, err)
+    }
+    defer db.Close()
+
+    return db.View(func(tx *bolt.Tx) error {
+        b := tx.Bucket(name); if b == nil {
+            return nil
+        }
+        return fn(b)
+    })
+}
+
+// Open the database and run fn in a read-write transaction on the bucket name, creating it if necessary.
+func (s *boltStore) update(name []byte, fn func(b *bolt.Bucket) error) error {
+    db, err := bolt.Open(s.path, 0600, &bolt.Options{Timeout: lockTimeout}); if err != nil {
+        return fmt.Errorf("Failed to open state file %s: %s", s.path, err)
+    }
+    defer db.Close()
+
+    return db.Update(func(tx *bolt.Tx) error {
+        b, err := tx.CreateBucketIfNotExists(name); if err != nil {
+            return err
+        }
+        return fn(b)
+    })
+}
+
+// Decode a stored record. Returns nil for missing data.
+func decode(data []byte) (*Record, error) {
+    if data == nil {
+        return nil, nil
+    }
+
+    rec := &Record{}
+    err := json.Unmarshal(data, rec); if err != nil {
+        return nil, fmt.Errorf("Failed to decode state record: %s", err)
+    }
+    return rec, nil
+}
+
+// Decode a stored pending entry. Returns nil for missing data.
+func decodePending(data []byte) (*Pending, error) {
+    if data == nil {
+        return nil, nil
+    }
+
+    p := &Pending{}
+    err := json.Unmarshal(data, p); if err != nil {
+        return nil, fmt.Errorf("Failed to decode pending entry: %s", err)
+    }
+    return p, nil
+}
@@ -0,0 +1,47 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package state
+
+import (
+    "errors"
+    "time"
+)
+
+// Returned by Store.AddPending if a new entry would exceed the maximum number of pending entries.
+var ErrQueueFull = errors.New("Too many zones waiting for approval")
+
+// A NOTIFY for an unknown zone waiting for an operator's approval.
+type Pending struct {
+    Zone string `json:"zone"`
+    // Remote the latest NOTIFY came from
+    Remote string `json:"remote"`
+    // Latest SOA serial seen, by RFC 1982 serial arithmetic
+    Serial uint32 `json:"serial"`
+    FirstSeen time.Time `json:"first_seen"`
+    LastNotify time.Time `json:"last_notify"`
+    // When the entry is dropped unless approved
+    Expires time.Time `json:"expires"`
+}
+
+// Check whether or not p has expired at t.
+func (p *Pending) Expired(t time.Time) bool {
+    return !t.Before(p.Expires)
+}
+
+// Apply a NOTIFY to p, which may be nil or expired, and return the resulting entry. Repeated NOTIFYs do not extend
+// the lifetime of an entry, so a zone notified over and over does not stay pending forever.
+func applyPending(p *Pending, zone, remote string, serial uint32, t time.Time, ttl time.Duration) *Pending {
+    if p == nil || p.Expired(t) {
+        p = &Pending{Zone: zone, FirstSeen: t, Expires: t.Add(ttl), Serial: serial}
+    }
+    p.Remote = remote
+    p.LastNotify = t
+    if !SerialAfter(p.Serial, serial) {
+        p.Serial = serial
+    }
+    return p
+}
@@ -0,0 +1,16 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package state
+
+// Half of the SOA serial number space, see RFC 1982.
+const serialHalf = 1 << 31
+
+// Check whether SOA serial a is later than b using RFC 1982 serial number arithmetic, so serials wrapping around
+// 2^32 still compare correctly. For the undefined case of serials exactly 2^31 apart, neither is later.
+func SerialAfter(a, b uint32) bool {
+    return (a < b && b - a > serialHalf) || (a > b && a - b < serialHalf)
+}
@@ -0,0 +1,27 @@
+package state
+
+import (
+    "testing"
+)
+
+func TestSerialAfter(t *testing.T) {
+    tests := []struct {
+        a, b uint32
+        expect bool
+    }{
+        {2, 1, true},
+        {1, 2, false},
+        {1, 1, false},
+        {0, 4294967295, true},
+        {4294967295, 0, false},
+        {2018050101, 2018043002, true},
+        {100, 100 + serialHalf, false},
+        {100 + serialHalf, 100, false},
+    }
+
+    for _, test := range tests {
+        if res := SerialAfter(test.a, test.b); res != test.expect {
+            t.Errorf("SerialAfter(%d, %d) = %v, expected %v", test.a, test.b, res, test.expect)
+        }
+    }
+}
@@ -0,0 +1,218 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package state
+
+import (
+    "sort"
+    "sync"
+    "time"
+
+    "github.com/mandrakey/dnsync/bind"
+)
+
+// Everything dnsync remembers about a zone beyond what is stored in the handlers' configuration files.
+type Record struct {
+    Zone string `json:"zone"`
+    // Remote the first NOTIFY for the zone came from
+    Origin string `json:"origin"`
+    // Remote the latest NOTIFY came from
+    LastRemote string `json:"last_remote"`
+    FirstSeen time.Time `json:"first_seen"`
+    LastNotify time.Time `json:"last_notify"`
+    // Latest SOA serial seen, by RFC 1982 serial arithmetic
+    Serial uint32 `json:"serial"`
+    // Masters the handlers derived from the NOTIFY carrying the latest serial
+    Masters []bind.Master `json:"masters"`
+}
+
+// A Store keeps a Record for every zone dnsync received a NOTIFY for.
+type Store interface {
+    // Retrieve the record of zone, or nil if the zone is unknown.
+    Get(zone string) (*Record, error)
+
+    // Retrieve the records of all known zones, sorted by zone name.
+    List() ([]*Record, error)
+
+    // Record a NOTIFY for zone from remote carrying serial, from which the handlers derived masters, received at t.
+    // Returns the updated record.
+    Notify(zone, remote string, serial uint32, masters []bind.Master, t time.Time) (*Record, error)
+
+    // Forget about zone, so the next NOTIFY for it is treated like one for a new zone.
+    Delete(zone string) error
+
+    // Queue a NOTIFY for the unknown zone from remote carrying serial, received at t, for approval. A new entry
+    // expires after ttl. Entries expired at t are removed first. If max is positive and max entries are pending
+    // already, a new entry is refused with ErrQueueFull. Returns the updated entry.
+    AddPending(zone, remote string, serial uint32, t time.Time, ttl time.Duration, max int) (*Pending, error)
+
+    // Retrieve the pending entry of zone, or nil if there is none or it expired at t.
+    GetPending(zone string, t time.Time) (*Pending, error)
+
+    // Retrieve all pending entries not expired at t, sorted by zone name. Expired entries are removed.
+    ListPending(t time.Time) ([]*Pending, error)
+
+    // Remove the pending entry of zone.
+    DeletePending(zone string) error
+
+    // Release all resources held by the Store.
+    Close() error
+}
+
+// Open the Store configured by path: a bbolt database file, or a memory store if path is empty.
+func New(path string) (Store, error) {
+    if path == "" {
+        return NewMemoryStore(), nil
+    }
+    return Open(path)
+}
+
+// Apply a NOTIFY to rec, which may be nil for unknown zones, and return the resulting record. The serial and the
+// masters are only taken over if the serial is not older than the recorded one, since NOTIFYs may arrive out of
+// order.
+func applyNotify(rec *Record, zone, remote string, serial uint32, masters []bind.Master, t time.Time) *Record {
+    if rec == nil {
+        rec = &Record{Zone: zone, Origin: remote, FirstSeen: t, Serial: serial, Masters: masters}
+    }
+    rec.LastRemote = remote
+    rec.LastNotify = t
+    if !SerialAfter(rec.Serial, serial) {
+        rec.Serial = serial
+        rec.Masters = masters
+    }
+    return rec
+}
+
+// A Store keeping all records in memory, used when no state file is configured.
+type memoryStore struct {
+    mu sync.Mutex
+    records map[string]Record
+    pending map[string]Pending
+}
+
+// Create a new Store keeping all records in memory only.
+func NewMemoryStore() Store {
+    return &memoryStore{records: make(map[string]Record), pending: make(map[string]Pending)}
+}
+
+// Retrieve the record of zone, or nil if the zone is unknown.
+func (s *memoryStore) Get(zone string) (*Record, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    rec, ok := s.records[zone]; if !ok {
+        return nil, nil
+    }
+    return &rec, nil
+}
+
+// Retrieve the records of all known zones, sorted by zone name.
+func (s *memoryStore) List() ([]*Record, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    res := make([]*Record, 0, len(s.records))
+    for _, rec := range s.records {
+        rec := rec
+        res = append(res, &rec)
+    }
+    sort.Slice(res, func(i, j int) bool { return res[i].Zone < res[j].Zone })
+    return res, nil
+}
+
+// Record a NOTIFY for zone.
+func (s *memoryStore) Notify(zone, remote string, serial uint32, masters []bind.Master, t time.Time) (*Record,
+        error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var rec *Record
+    if old, ok := s.records[zone]; ok {
+        rec = &old
+    }
+    rec = applyNotify(rec, zone, remote, serial, masters, t)
+    s.records[zone] = *rec
+
+    res := *rec
+    return &res, nil
+}
+
+// Forget about zone.
+func (s *memoryStore) Delete(zone string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    delete(s.records, zone)
+    return nil
+}
+
+// Queue a NOTIFY for zone for approval.
+func (s *memoryStore) AddPending(zone, remote string, serial uint32, t time.Time, ttl time.Duration,
+        max int) (*Pending, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for z, p := range s.pending {
+        if p.Expired(t) {
+            delete(s.pending, z)
+        }
+    }
+
+    var p *Pending
+    if old, ok := s.pending[zone]; ok {
+        p = &old
+    } else if max > 0 && len(s.pending) >= max {
+        return nil, ErrQueueFull
+    }
+    p = applyPending(p, zone, remote, serial, t, ttl)
+    s.pending[zone] = *p
+
+    res := *p
+    return &res, nil
+}
+
+// Retrieve the pending entry of zone.
+func (s *memoryStore) GetPending(zone string, t time.Time) (*Pending, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    p, ok := s.pending[zone]; if !ok || p.Expired(t) {
+        return nil, nil
+    }
+    return &p, nil
+}
+
+// Retrieve all pending entries not expired at t.
+func (s *memoryStore) ListPending(t time.Time) ([]*Pending, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    res := make([]*Pending, 0, len(s.pending))
+    for zone, p := range s.pending {
+        p := p
+        if p.Expired(t) {
+            delete(s.pending, zone)
+            continue
+        }
+        res = append(res, &p)
+    }
+    sort.Slice(res, func(i, j int) bool { return res[i].Zone < res[j].Zone })
+    return res, nil
+}
+
+// Remove the pending entry of zone.
+func (s *memoryStore) DeletePending(zone string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    delete(s.pending, zone)
+    return nil
+}
+
+// Nothing to release for a memory store.
+func (s *memoryStore) Close() error {
+    return nil
+}
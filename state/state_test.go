@@ -0,0 +1,151 @@
+package state
+
+import (
+    "time"
+    "reflect"
+    "testing"
+    "path/filepath"
+
+    "github.com/mandrakey/dnsync/bind"
+)
+
+// Run the common Store tests against s.
+func testStore(t *testing.T, s Store) {
+    t1 := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+    t2 := t1.Add(time.Hour)
+
+    rec, err := s.Get("domain.tld"); if err != nil || rec != nil {
+        t.Fatalf("Unknown zone should yield no record: %v, %v", rec, err)
+    }
+
+    _, err = s.Notify("domain.tld", "1.2.3.4", 1, bind.MastersFrom("1.2.3.4"), t1); if err != nil {
+        t.Fatalf("Failed to record notify: %s", err)
+    }
+    rec, err = s.Notify("domain.tld", "5.6.7.8", 2, bind.MastersFrom("10.0.0.1"), t2); if err != nil {
+        t.Fatalf("Failed to record notify: %s", err)
+    }
+    if rec.Origin != "1.2.3.4" || rec.LastRemote != "5.6.7.8" || !rec.FirstSeen.Equal(t1) ||
+            !rec.LastNotify.Equal(t2) || rec.Serial != 2 ||
+            !bind.SameMasters(rec.Masters, bind.MastersFrom("10.0.0.1")) {
+        t.Fatalf("Record not updated correctly: %+v", rec)
+    }
+
+    got, err := s.Get("domain.tld"); if err != nil {
+        t.Fatalf("Failed to get record: %s", err)
+    }
+    if !reflect.DeepEqual(got, rec) {
+        t.Fatalf("Stored record differs.\nExpect: %+v\nActual: %+v", rec, got)
+    }
+
+    // Out of order NOTIFYs must not roll back the serial
+    rec, err = s.Notify("domain.tld", "1.2.3.4", 1, bind.MastersFrom("1.2.3.4"), t2)
+    if err != nil || rec.Serial != 2 || !bind.SameMasters(rec.Masters, bind.MastersFrom("10.0.0.1")) {
+        t.Fatalf("Older NOTIFY replaced newer one: %+v, %v", rec, err)
+    }
+
+    s.Notify("a.tld", "1.2.3.4", 1, nil, t1)
+    list, err := s.List(); if err != nil {
+        t.Fatalf("Failed to list records: %s", err)
+    }
+    if len(list) != 2 || list[0].Zone != "a.tld" || list[1].Zone != "domain.tld" {
+        t.Fatalf("Records not listed correctly: %v", list)
+    }
+
+    err = s.Delete("a.tld"); if err != nil {
+        t.Fatalf("Failed to delete record: %s", err)
+    }
+    rec, err = s.Get("a.tld"); if err != nil || rec != nil {
+        t.Fatalf("Deleted record still present: %v, %v", rec, err)
+    }
+}
+
+// Run the common pending queue tests against s.
+func testPending(t *testing.T, s Store) {
+    t1 := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+    ttl := 24 * time.Hour
+
+    p, err := s.GetPending("domain.tld", t1); if err != nil || p != nil {
+        t.Fatalf("Unknown zone should not be pending: %v, %v", p, err)
+    }
+
+    s.AddPending("domain.tld", "1.2.3.4", 1, t1, ttl, 0)
+    p, err = s.AddPending("domain.tld", "5.6.7.8", 2, t1.Add(time.Hour), ttl, 0); if err != nil {
+        t.Fatalf("Failed to queue notify: %s", err)
+    }
+    if p.Remote != "5.6.7.8" || p.Serial != 2 || !p.FirstSeen.Equal(t1) || !p.Expires.Equal(t1.Add(ttl)) {
+        t.Fatalf("Pending entry not updated correctly: %+v", p)
+    }
+    got, err := s.GetPending("domain.tld", t1.Add(time.Hour)); if err != nil || got == nil || *got != *p {
+        t.Fatalf("Stored pending entry differs: %+v, %v", got, err)
+    }
+
+    s.AddPending("a.tld", "1.2.3.4", 1, t1.Add(2 * time.Hour), ttl, 0)
+    list, err := s.ListPending(t1.Add(time.Hour)); if err != nil {
+        t.Fatalf("Failed to list pending entries: %s", err)
+    }
+    if len(list) != 2 || list[0].Zone != "a.tld" || list[1].Zone != "domain.tld" {
+        t.Fatalf("Pending entries not listed correctly: %v", list)
+    }
+
+    // Expired entries are dropped
+    expired := t1.Add(ttl)
+    if p, _ := s.GetPending("domain.tld", expired); p != nil {
+        t.Fatalf("Expired entry still pending: %+v", p)
+    }
+    list, _ = s.ListPending(expired)
+    if len(list) != 1 || list[0].Zone != "a.tld" {
+        t.Fatalf("Expired entries listed: %v", list)
+    }
+    p, _ = s.AddPending("domain.tld", "1.2.3.4", 3, expired, ttl, 0)
+    if !p.FirstSeen.Equal(expired) {
+        t.Fatalf("Expired entry was not replaced: %+v", p)
+    }
+
+    // Expired entries are purged when queueing and do not count against the limit
+    later := t1.Add(2 * ttl)
+    p, err = s.AddPending("b.tld", "1.2.3.4", 1, later, ttl, 1); if err != nil {
+        t.Fatalf("Expired entries count against the limit: %s", err)
+    }
+    list, _ = s.ListPending(t1)
+    if len(list) != 1 || list[0].Zone != "b.tld" {
+        t.Fatalf("Expired entries not purged when queueing: %v", list)
+    }
+    _, err = s.AddPending("c.tld", "1.2.3.4", 1, later, ttl, 1); if err != ErrQueueFull {
+        t.Fatalf("Entry beyond the limit should be refused: %v", err)
+    }
+    p, err = s.AddPending("b.tld", "1.2.3.4", 2, later, ttl, 1); if err != nil || p.Serial != 2 {
+        t.Fatalf("Pending zone should be updated at the limit: %+v, %v", p, err)
+    }
+    s.AddPending("a.tld", "1.2.3.4", 1, t1, ttl, 0)
+
+    err = s.DeletePending("a.tld"); if err != nil {
+        t.Fatalf("Failed to delete pending entry: %s", err)
+    }
+    if p, _ := s.GetPending("a.tld", t1); p != nil {
+        t.Fatalf("Deleted entry still pending: %+v", p)
+    }
+}
+
+func TestMemoryStore(t *testing.T) {
+    testStore(t, NewMemoryStore())
+    testPending(t, NewMemoryStore())
+}
+
+func TestBoltStore(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "state.db")
+    s, err := Open(path); if err != nil {
+        t.Fatalf("Failed to open store: %s", err)
+    }
+    testStore(t, s)
+    testPending(t, s)
+    s.Close()
+
+    // Records must survive reopening
+    s, err = Open(path); if err != nil {
+        t.Fatalf("Failed to reopen store: %s", err)
+    }
+    defer s.Close()
+    rec, err := s.Get("domain.tld"); if err != nil || rec == nil || rec.Serial != 2 {
+        t.Fatalf("Record lost after reopening: %v, %v", rec, err)
+    }
+}
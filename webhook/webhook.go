@@ -0,0 +1,186 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package webhook
+
+import (
+    "fmt"
+    "sync"
+    "time"
+    "bytes"
+    "net/http"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+
+    "github.com/op/go-logging"
+
+    "github.com/mandrakey/dnsync/bind"
+    "github.com/mandrakey/dnsync/config"
+)
+
+// Header carrying the HMAC-SHA256 of the request body, keyed with the webhook's secret, as "sha256=<hex>".
+const SignatureHeader = "X-Dnsync-Signature"
+
+// Defaults of unset webhook configuration values.
+const (
+    DEFAULT_BACKOFF = time.Second
+    DEFAULT_TIMEOUT = 10 * time.Second
+)
+
+// Actions triggering a webhook if none are configured.
+var defaultActions = []string{"added", "updated", "removed"}
+
+// A change of a handler's zone set, sent as JSON payload to the webhooks.
+type Event struct {
+    Zone string `json:"zone"`
+    Masters []bind.Master `json:"masters"`
+    Handler string `json:"handler"`
+    Action string `json:"action"`
+    Timestamp time.Time `json:"timestamp"`
+    // Address of the remote that caused the change, i.e. the sender of the NOTIFY or the API client
+    Remote string `json:"remote"`
+}
+
+// Delivers events to all configured webhooks in the background.
+type Dispatcher struct {
+    hooks []*hook
+    log *logging.Logger
+    wg sync.WaitGroup
+}
+
+// A single configured webhook.
+type hook struct {
+    cfg config.Webhook
+    actions map[string]bool
+    backoff time.Duration
+    client *http.Client
+}
+
+// Create a Dispatcher for the webhooks configured in cfgs.
+func New(cfgs []config.Webhook, log *logging.Logger) (*Dispatcher, error) {
+    d := &Dispatcher{log: log}
+    for _, cfg := range cfgs {
+        h, err := newHook(cfg); if err != nil {
+            return nil, err
+        }
+        d.hooks = append(d.hooks, h)
+    }
+    return d, nil
+}
+
+// Create a hook from its configuration.
+func newHook(cfg config.Webhook) (*hook, error) {
+    if cfg.URL == "" {
+        return nil, fmt.Errorf("Webhook without url")
+    }
+
+    h := &hook{cfg: cfg, actions: make(map[string]bool), backoff: DEFAULT_BACKOFF}
+    actions := cfg.Actions
+    if len(actions) == 0 {
+        actions = defaultActions
+    }
+    for _, a := range actions {
+        h.actions[a] = true
+    }
+
+    var err error
+    if cfg.Backoff != "" {
+        h.backoff, err = time.ParseDuration(cfg.Backoff); if err != nil {
+            return nil, fmt.Errorf("Invalid backoff of webhook %s: %s", cfg.URL, err)
+        }
+    }
+    timeout := DEFAULT_TIMEOUT
+    if cfg.Timeout != "" {
+        timeout, err = time.ParseDuration(cfg.Timeout); if err != nil {
+            return nil, fmt.Errorf("Invalid timeout of webhook %s: %s", cfg.URL, err)
+        }
+    }
+    h.client = &http.Client{Timeout: timeout}
+    return h, nil
+}
+
+// Send e to all webhooks interested in its action. Delivery happens in the background; Send does not block. A
+// nil Dispatcher sends nothing.
+func (d *Dispatcher) Send(e Event) {
+    if d == nil {
+        return
+    }
+
+    body, err := json.Marshal(e); if err != nil {
+        d.log.Errorf("Failed to encode webhook event: %s", err)
+        return
+    }
+    for _, h := range d.hooks {
+        if h.actions[e.Action] {
+            d.wg.Add(1)
+            go d.deliver(h, e, body)
+        }
+    }
+}
+
+// Wait until all events sent so far are delivered or given up on.
+func (d *Dispatcher) Wait() {
+    if d != nil {
+        d.wg.Wait()
+    }
+}
+
+// Post body to h, retrying with exponential backoff.
+func (d *Dispatcher) deliver(h *hook, e Event, body []byte) {
+    defer d.wg.Done()
+    fields := config.Fields{"zone": e.Zone, "handler": e.Handler, "action": e.Action, "webhook": h.cfg.URL}
+
+    delay := h.backoff
+    for attempt := 0; ; attempt++ {
+        retry, err := h.post(body); if err == nil {
+            d.log.Debug(config.NewEvent("Webhook delivered", fields))
+            return
+        }
+        fields["error"] = err.Error()
+        fields["attempt"] = attempt + 1
+
+        if !retry || attempt >= h.cfg.Retries {
+            d.log.Error(config.NewEvent("Webhook delivery failed", fields))
+            return
+        }
+        d.log.Warning(config.NewEvent(fmt.Sprintf("Webhook delivery failed, retrying in %s", delay), fields))
+        time.Sleep(delay)
+        delay *= 2
+    }
+}
+
+// Post body to the webhook once. Returns whether or not a failed delivery is worth retrying.
+func (h *hook) post(body []byte) (bool, error) {
+    req, err := http.NewRequest(http.MethodPost, h.cfg.URL, bytes.NewReader(body)); if err != nil {
+        return false, err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("User-Agent", "dnsync")
+    if h.cfg.Secret != "" {
+        req.Header.Set(SignatureHeader, Sign(h.cfg.Secret, body))
+    }
+
+    res, err := h.client.Do(req); if err != nil {
+        return true, err
+    }
+    res.Body.Close()
+
+    if res.StatusCode >= 200 && res.StatusCode < 300 {
+        return false, nil
+    }
+    // Client errors other than rate limiting will not go away by retrying
+    retry := res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests
+    return retry, fmt.Errorf("Webhook answered with status %s", res.Status)
+}
+
+// Compute the signature of body for secret as sent in SignatureHeader.
+func Sign(secret string, body []byte) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write(body)
+    return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
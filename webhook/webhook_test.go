@@ -0,0 +1,137 @@
+package webhook
+
+import (
+    "sync"
+    "time"
+    "testing"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "encoding/json"
+
+    "github.com/op/go-logging"
+
+    "github.com/mandrakey/dnsync/bind"
+    "github.com/mandrakey/dnsync/config"
+)
+
+// Create a logger discarding all output.
+func testLogger() *logging.Logger {
+    log := logging.MustGetLogger("test")
+    log.SetBackend(logging.AddModuleLevel(logging.NewLogBackend(ioutil.Discard, "", 0)))
+    return log
+}
+
+// A webhook endpoint answering with the given status codes in turn and recording all requests.
+type receiver struct {
+    mu sync.Mutex
+    statuses []int
+    bodies [][]byte
+    signatures []string
+}
+
+// Record a request and answer it with the next status.
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    rc.mu.Lock()
+    defer rc.mu.Unlock()
+
+    body, _ := ioutil.ReadAll(r.Body)
+    rc.bodies = append(rc.bodies, body)
+    rc.signatures = append(rc.signatures, r.Header.Get(SignatureHeader))
+
+    status := http.StatusOK
+    if len(rc.statuses) > 0 {
+        status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+    }
+    w.WriteHeader(status)
+}
+
+// Get the number of requests received so far.
+func (rc *receiver) count() int {
+    rc.mu.Lock()
+    defer rc.mu.Unlock()
+    return len(rc.bodies)
+}
+
+// Start a receiver answering with statuses and a Dispatcher for a single webhook pointing to it.
+func testDispatcher(t *testing.T, cfg config.Webhook, statuses ...int) (*Dispatcher, *receiver) {
+    rc := &receiver{statuses: statuses}
+    srv := httptest.NewServer(rc)
+    t.Cleanup(srv.Close)
+
+    cfg.URL = srv.URL
+    d, err := New([]config.Webhook{cfg}, testLogger()); if err != nil {
+        t.Fatalf("Failed to create dispatcher: %s", err)
+    }
+    return d, rc
+}
+
+func TestDeliverWithRetries(t *testing.T) {
+    d, rc := testDispatcher(t, config.Webhook{Secret: "s3cret", Retries: 2, Backoff: "10ms"},
+        http.StatusInternalServerError, http.StatusServiceUnavailable)
+
+    e := Event{Zone: "domain.tld", Masters: bind.MastersFrom("192.0.2.1"), Handler: "bind", Action: "added",
+        Timestamp: time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC), Remote: "192.0.2.1"}
+    d.Send(e)
+    d.Wait()
+
+    if rc.count() != 3 {
+        t.Fatalf("Expected 3 attempts, got %d", rc.count())
+    }
+    for i, body := range rc.bodies {
+        if rc.signatures[i] != Sign("s3cret", body) {
+            t.Fatalf("Wrong signature %q for %s", rc.signatures[i], body)
+        }
+    }
+
+    got := Event{}
+    err := json.Unmarshal(rc.bodies[2], &got); if err != nil {
+        t.Fatalf("Failed to decode payload: %s", err)
+    }
+    if got.Zone != e.Zone || got.Handler != e.Handler || got.Action != e.Action || got.Remote != e.Remote ||
+            !got.Timestamp.Equal(e.Timestamp) || len(got.Masters) != 1 || got.Masters[0] != e.Masters[0] {
+        t.Fatalf("Wrong payload: %s", rc.bodies[2])
+    }
+}
+
+func TestDeliverGivesUp(t *testing.T) {
+    d, rc := testDispatcher(t, config.Webhook{Retries: 5, Backoff: "10ms"}, http.StatusBadRequest)
+    d.Send(Event{Zone: "domain.tld", Action: "added"})
+    d.Wait()
+    if rc.count() != 1 || rc.signatures[0] != "" {
+        t.Fatalf("Client error was retried or signed without secret: %d attempts", rc.count())
+    }
+
+    d, rc = testDispatcher(t, config.Webhook{Retries: 1, Backoff: "10ms"}, 500, 500, 500)
+    d.Send(Event{Zone: "domain.tld", Action: "added"})
+    d.Wait()
+    if rc.count() != 2 {
+        t.Fatalf("Expected 2 attempts, got %d", rc.count())
+    }
+}
+
+func TestDeliverSelectedActions(t *testing.T) {
+    d, rc := testDispatcher(t, config.Webhook{Actions: []string{"removed"}})
+    d.Send(Event{Zone: "domain.tld", Action: "added"})
+    d.Send(Event{Zone: "domain.tld", Action: "removed"})
+    d.Wait()
+    if rc.count() != 1 {
+        t.Fatalf("Expected only the removal to be delivered, got %d requests", rc.count())
+    }
+
+    var none *Dispatcher
+    none.Send(Event{Zone: "domain.tld", Action: "added"})
+    none.Wait()
+}
+
+func TestNewInvalid(t *testing.T) {
+    for _, cfg := range []config.Webhook{
+        {},
+        {URL: "http://localhost", Backoff: "soon"},
+        {URL: "http://localhost", Timeout: "10"},
+    } {
+        if _, err := New([]config.Webhook{cfg}, testLogger()); err == nil {
+            t.Fatalf("Invalid webhook %+v accepted", cfg)
+        }
+    }
+}
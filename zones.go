@@ -0,0 +1,314 @@
+/* This file is part of DNSync.
+ *
+ * Copyright (C) 2018 Maurice Bleuel <mandrakey@bleuelmedia.com>
+ * Licensed undert the simplified BSD license. For further details see COPYING.
+ */
+
+package main
+
+import (
+    "os"
+    "fmt"
+    "time"
+    "text/tabwriter"
+
+    "github.com/mandrakey/dnsync/bind"
+    "github.com/mandrakey/dnsync/config"
+    "github.com/mandrakey/dnsync/handler"
+    "github.com/mandrakey/dnsync/state"
+
+    "github.com/urfave/cli"
+)
+
+// Flag selecting the handler to operate on.
+var handlerFlag = cli.StringFlag{
+    Name: "handler",
+    Usage: "Operate on the handler `NAME`; may be omitted if only one handler manages zones",
+}
+
+// Offline administration of the zones managed by the configured handlers. These commands work directly on the
+// handlers' configuration files and do not need a running dnsync.
+var zonesCommand = cli.Command{
+    Name: "zones",
+    Usage: "List and edit the zones managed by handlers",
+    Subcommands: []cli.Command{
+        {
+            Name: "list",
+            Usage: "List all zones",
+            Flags: []cli.Flag{handlerFlag},
+            Action: actionZonesList,
+        },
+        {
+            Name: "show",
+            Usage: "Show a single zone",
+            ArgsUsage: "<zone>",
+            Flags: []cli.Flag{handlerFlag},
+            Action: actionZonesShow,
+        },
+        {
+            Name: "add",
+            Usage: "Add a zone or update an existing one",
+            ArgsUsage: "<zone>",
+            Flags: []cli.Flag{
+                handlerFlag,
+                cli.StringSliceFlag{
+                    Name: "master, m",
+                    Usage: "Use `MASTER` as master of the zone, e.g. \"192.0.2.1 port 5353 key xfr\"; may be given several times",
+                },
+                cli.StringFlag{
+                    Name: "file",
+                    Usage: "Store the zone in `FILE` instead of the handler's default location",
+                },
+            },
+            Action: actionZonesAdd,
+        },
+        {
+            Name: "remove",
+            Usage: "Remove a zone",
+            ArgsUsage: "<zone>",
+            Flags: []cli.Flag{handlerFlag},
+            Action: actionZonesRemove,
+        },
+    },
+}
+
+// List the zones of the selected handler, or of all handlers if none is selected, along with the state recorded
+// for them.
+func actionZonesList(c *cli.Context) error {
+    stores, err := loadZoneStores(); if err != nil {
+        return err
+    }
+    records, err := loadRecords(); if err != nil {
+        return err
+    }
+
+    names := stores.names
+    if c.String("handler") != "" {
+        _, err := stores.get(c.String("handler")); if err != nil {
+            return err
+        }
+        names = []string{c.String("handler")}
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "HANDLER\tZONE\tMASTERS\tFILE\tFIRST SEEN\tLAST NOTIFY\tSERIAL")
+    for _, name := range names {
+        zones, err := stores.byName[name].Zones(); if err != nil {
+            return err
+        }
+        for _, zone := range zones {
+            rec := records[zone.Name]
+            serial := "-"
+            if rec != nil {
+                serial = fmt.Sprint(rec.Serial)
+            }
+            fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", name, zone.Name, bind.JoinMasters(zone.Masters, ", "), zone.File,
+                formatTime(rec, func(r *state.Record) time.Time { return r.FirstSeen }),
+                formatTime(rec, func(r *state.Record) time.Time { return r.LastNotify }), serial)
+        }
+    }
+    return w.Flush()
+}
+
+// Show a single zone of the selected handler.
+func actionZonesShow(c *cli.Context) error {
+    name, err := zoneArg(c); if err != nil {
+        return err
+    }
+    store, err := selectZoneStore(c); if err != nil {
+        return err
+    }
+
+    zones, err := store.Zones(); if err != nil {
+        return err
+    }
+    for _, zone := range zones {
+        if zone.Name == name {
+            fmt.Printf("Zone:    %s\n", zone.Name)
+            fmt.Printf("Masters: %s\n", bind.JoinMasters(zone.Masters, ", "))
+            fmt.Printf("File:    %s\n", zone.File)
+            return showRecord(name)
+        }
+    }
+    return fmt.Errorf("No such zone: %s", name)
+}
+
+// Print the state recorded for zone, if any.
+func showRecord(zone string) error {
+    store, err := loadState(); if err != nil {
+        return err
+    }
+    defer store.Close()
+
+    rec, err := store.Get(zone); if err != nil || rec == nil {
+        return err
+    }
+    fmt.Printf("Origin:      %s\n", rec.Origin)
+    fmt.Printf("First seen:  %s\n", rec.FirstSeen.Format(time.RFC3339))
+    fmt.Printf("Last notify: %s from %s\n", rec.LastNotify.Format(time.RFC3339), rec.LastRemote)
+    fmt.Printf("Serial:      %d\n", rec.Serial)
+    return nil
+}
+
+// Read all recorded zone states, keyed by zone name.
+func loadRecords() (map[string]*state.Record, error) {
+    store, err := loadState(); if err != nil {
+        return nil, err
+    }
+    defer store.Close()
+
+    records, err := store.List(); if err != nil {
+        return nil, err
+    }
+    res := make(map[string]*state.Record)
+    for _, rec := range records {
+        res[rec.Zone] = rec
+    }
+    return res, nil
+}
+
+// Format a time taken from rec for listings, or "-" if there is no record.
+func formatTime(rec *state.Record, get func(r *state.Record) time.Time) string {
+    if rec == nil {
+        return "-"
+    }
+    return get(rec).Format(time.RFC3339)
+}
+
+// Add a zone to the selected handler.
+func actionZonesAdd(c *cli.Context) error {
+    name, err := zoneArg(c); if err != nil {
+        return err
+    }
+    if len(c.StringSlice("master")) == 0 {
+        return fmt.Errorf("At least one --master is required")
+    }
+    handlerName, store, err := selectNamedZoneStore(c); if err != nil {
+        return err
+    }
+    hooks, err := loadHooks(); if err != nil {
+        return err
+    }
+    defer hooks.Wait()
+
+    zone := &bind.Zone{Name: name, File: c.String("file")}
+    for _, s := range c.StringSlice("master") {
+        m, err := bind.ParseMaster(s); if err != nil {
+            return err
+        }
+        zone.Masters = append(zone.Masters, m)
+    }
+    action, err := store.AddZone(zone); if err != nil {
+        return err
+    }
+    fmt.Printf("%s: %s\n", zone.Name, action)
+    sendZoneEvent(hooks, handlerName, zone, action)
+    return nil
+}
+
+// Remove a zone from the selected handler.
+func actionZonesRemove(c *cli.Context) error {
+    name, err := zoneArg(c); if err != nil {
+        return err
+    }
+    handlerName, store, err := selectNamedZoneStore(c); if err != nil {
+        return err
+    }
+    hooks, err := loadHooks(); if err != nil {
+        return err
+    }
+    defer hooks.Wait()
+
+    // Look the zone up first, so the webhooks get its masters
+    zone := &bind.Zone{Name: name}
+    zones, err := store.Zones(); if err != nil {
+        return err
+    }
+    for _, z := range zones {
+        if z.Name == name {
+            zone = z
+        }
+    }
+
+    action, err := store.RemoveZone(name); if err != nil {
+        return err
+    }
+    if action == handler.ACTION_UNCHANGED {
+        return fmt.Errorf("No such zone: %s", name)
+    }
+    fmt.Printf("%s: %s\n", name, action)
+    sendZoneEvent(hooks, handlerName, zone, action)
+
+    // Forget the zone, so the next NOTIFY for it is not skipped
+    states, err := loadState(); if err != nil {
+        return err
+    }
+    defer states.Close()
+    return states.Delete(name)
+}
+
+// The configured handlers managing zones, in configuration order.
+type zoneStores struct {
+    names []string
+    byName map[string]handler.ZoneStore
+}
+
+// Create all configured handlers and collect those managing zones.
+func loadZoneStores() (*zoneStores, error) {
+    cfg, err := loadConfig(); if err != nil {
+        return nil, err
+    }
+
+    handlers, err := handler.NewAll(cfg, config.NewLogger(cfg)); if err != nil {
+        return nil, err
+    }
+
+    res := &zoneStores{byName: make(map[string]handler.ZoneStore)}
+    for _, h := range handlers {
+        if store, ok := h.(handler.ZoneStore); ok {
+            res.names = append(res.names, h.Name())
+            res.byName[h.Name()] = store
+        }
+    }
+    return res, nil
+}
+
+// Get the zone store of the handler name.
+func (s *zoneStores) get(name string) (handler.ZoneStore, error) {
+    store, ok := s.byName[name]; if !ok {
+        return nil, fmt.Errorf("No handler %s managing zones", name)
+    }
+    return store, nil
+}
+
+// Get the zone store of the handler selected with --handler. Without --handler, the only handler managing zones
+// is used.
+func selectZoneStore(c *cli.Context) (handler.ZoneStore, error) {
+    _, store, err := selectNamedZoneStore(c)
+    return store, err
+}
+
+// Get the name and the zone store of the handler selected with --handler, see selectZoneStore.
+func selectNamedZoneStore(c *cli.Context) (string, handler.ZoneStore, error) {
+    stores, err := loadZoneStores(); if err != nil {
+        return "", nil, err
+    }
+
+    name := c.String("handler")
+    if name == "" {
+        if len(stores.names) != 1 {
+            return "", nil, fmt.Errorf("%d handlers manage zones, select one with --handler", len(stores.names))
+        }
+        name = stores.names[0]
+    }
+    store, err := stores.get(name)
+    return name, store, err
+}
+
+// Get the zone name given as first argument in normalized form, see bind.NormalizeZoneName.
+func zoneArg(c *cli.Context) (string, error) {
+    if c.Args().First() == "" {
+        return "", fmt.Errorf("A zone name is required")
+    }
+    return bind.NormalizeZoneName(c.Args().First())
+}